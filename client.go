@@ -13,5 +13,6 @@ type client interface {
 	CreateInOrder(path, value string, ttl uint64) (*etcd.Response, error)
 	Set(path, value string, ttl uint64) (*etcd.Response, error)
 	Get(path string, sort, recursive bool) (*etcd.Response, error)
+	Delete(path string, recursive bool) (*etcd.Response, error)
 	Watch(path string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
 }
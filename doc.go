@@ -9,21 +9,21 @@
 // We took some decisions when creating this library taking into account that less is more. The
 // decisions are all listed bellow.
 //
-// Always retrieving the last index: For the use case that we thought, there's no reason (for now)
-// to retrieve an intermediate state of a field. We are always looking for the current value in
-// etcd. But we store the index of all attributes retrieved from etcd so that the user wants to know
-// it (in the library we use "version" instead of "index" because it appears to have a better
-// context).
+// Always retrieving the last index: For the use case that we thought, there's no reason to retrieve
+// an intermediate state of a field into the configuration. We are always looking for the current
+// value in etcd. But we store the index of all attributes retrieved from etcd so that the user wants
+// to know it (in the library we use "version" instead of "index" because it appears to have a better
+// context). When you need to know how a field was in a past index (reviewing a bad change, for
+// example), LoadAt and LoadFieldAt rebuild it from the etcd events history into a separated value.
 //
 // Setting unlimited TTL: The type of data that we store in etcd (configuration values) don't need a
 // TTL. Or at least we did not imagine any case when it does need a TTL.
 //
 // Ignoring errors occurred in watch: When something goes wrong while retrieving or parsing the data
-// from etcd, we prefer to silent drop the update instead of setting a strange value to the
-// configuration field. Another problem is to create a good API to notify about errors occurred in
-// watch, the first idea is to use a channel for errors, but it doesn't appears to be a elegant
-// approach, and more than that, what the user can do with this error? Well, we are still thinking
-// about it.
+// from etcd, we prefer to drop the update instead of setting a strange value to the configuration
+// field. The errors are only reported to the handler defined with the WithErrorHandler option. When
+// the watch itself fails, it's resumed after the last received change with an exponential backoff.
+// The field is only loaded again when etcd doesn't have the missed changes anymore.
 //
 // Ignoring "directory already exist" errors: If the directory already exists, great! We go on and
 // create the structure under this directory. There's no reason to stop everything because of this
@@ -40,12 +40,10 @@
 // is terrible with all the reflection used, and with a good re-factory the repeated code could be
 // reused. The full test coverage will ensure that the re-factory does not break anything.
 //
-// Second, when watching a field, you will receive a channel to notify when you want to stop
-// watching. Now if you send a boolean false into the channel instead of closing it, we could have a
-// strange behavior since there are two go routines listening on this channel (go-etcd and etcetera
-// watch functions).
-//
-// And finally, we could have concurrency issues while updating configuration fields caused by the
-// watch service. We still need to test the possible cases, but adding a read/write lock don't
-// appears to be an elegant solution.
+// And finally, the watch service updates the configuration fields while the application reads
+// them. The fields are only replaced holding a lock, so plain fields must still be read inside the
+// Read method to avoid data races. Fields that are read very often can use the Value type, that is
+// replaced atomically and read without any lock, and the Snapshot method returns a consistent copy
+// of the whole configuration that can be read freely. It would be nice to have the same for plain
+// fields without changing their types.
 package etcetera
@@ -5,11 +5,16 @@
 package etcetera
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 )
@@ -30,18 +35,32 @@ var (
 	// ErrFieldNotAddr is throw when a field that cannot be addressable is used in a place that we
 	// need the pointer to identify the path related to the field
 	ErrFieldNotAddr = errors.New("etcetera: field must be a pointer or an addressable value")
+
+	// ErrInvalidEntry alert whenever you try to access an entry of a field that isn't a map with
+	// string keys or a slice, or when the index is out of the slice range
+	ErrInvalidEntry = errors.New("etcetera: entry must be a key of a map or an index of a slice")
+
+	// ErrInvalidTarget alert whenever you try to load data into something that is not a pointer to
+	// the same type of the configuration or field
+	ErrInvalidTarget = errors.New("etcetera: target must be a pointer to the same type of the configuration or field")
 )
 
 // https://github.com/coreos/etcd/blob/master/error/error.go
 const (
-	etcdErrorCodeKeyNotFound  etcdErrorCode = 100 // used in tests
-	etcdErrorCodeNotFile      etcdErrorCode = 102 // used in tests
-	etcdErrorCodeNodeExist    etcdErrorCode = 105
-	etcdErrorCodeRaftInternal etcdErrorCode = 300 // used in tests
+	etcdErrorCodeKeyNotFound       etcdErrorCode = 100
+	etcdErrorCodeNotFile           etcdErrorCode = 102 // used in tests
+	etcdErrorCodeNodeExist         etcdErrorCode = 105
+	etcdErrorCodeEventIndexCleared etcdErrorCode = 401
+	etcdErrorCodeRaftInternal      etcdErrorCode = 300 // used in tests
 )
 
 type etcdErrorCode int
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// defaultHistoryTimeout is used when the client doesn't define the history timeout
+const defaultHistoryTimeout = time.Second
+
 // Client stores the etcd connection, the configuration instance that we are managing and some extra
 // informations that are useful for controlling path versions and making the API simpler
 type Client struct {
@@ -49,14 +68,145 @@ type Client struct {
 	namespace  string
 	config     reflect.Value
 
+	// concurrency is the maximum number of requests sent to etcd at the same time when saving or
+	// loading the configuration
+	concurrency int
+
+	// loadMode defines how the configuration is retrieved from etcd
+	loadMode LoadMode
+
+	// index is the etcd index of the last load
+	index uint64
+
+	// strict makes the load fail when etcd has keys in the namespace that don't match any field
+	strict bool
+
+	// boolAliases are extra values accepted for boolean fields, besides the ones of strconv.ParseBool
+	boolAliases map[string]bool
+
+	// historyTimeout is how long we wait for a past change that may not exist when rebuilding a path
+	// as it was in a past index
+	historyTimeout time.Duration
+
 	// info creates a correlation between a path to a info structure that stores some extra
 	// information and make the API usage easier
 	info map[string]info
+
+	// configLock protects the configuration fields, that are modified by loads and watches while the
+	// application reads them
+	configLock sync.RWMutex
+
+	// lock protects the information of the paths, the index and the settings of the client, as they
+	// are used by watches in other go routines
+	lock sync.RWMutex
+
+	// snapshot is the copy of the configuration published after the last load or update
+	snapshot     atomic.Pointer[Snapshot]
+	snapshotLock sync.Mutex
+}
+
+// LoadMode defines how the configuration is retrieved from etcd when loading
+type LoadMode int
+
+// List of possible modes to load the configuration
+const (
+	// LoadFields sends a recursive request for each field of the configuration (default)
+	LoadFields LoadMode = iota
+
+	// LoadNamespace sends a single recursive request for the namespace and fills the whole
+	// configuration with it. All fields are retrieved from the same etcd index
+	LoadNamespace
+)
+
+// UnknownKeysError is returned by a strict load when there are keys in the etcd namespace that
+// don't match any field of the configuration
+type UnknownKeysError struct {
+	Keys []string
+}
+
+func (e *UnknownKeysError) Error() string {
+	return "etcetera: keys don't match any field of the configuration: " + strings.Join(e.Keys, ", ")
+}
+
+// RejectedError is reported when the approval function of a watch (WithApproval option) rejects a
+// new value. The field keeps the previous value
+type RejectedError struct {
+	Err error // reason returned by the approval function
+}
+
+func (e *RejectedError) Error() string {
+	return "etcetera: new value rejected: " + e.Err.Error()
+}
+
+// Unwrap returns the reason of the rejection
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError describes a problem with a specific path of the configuration, like an etcd value
+// that cannot be converted to the type of the field, or a request that failed for the path
+type FieldError struct {
+	Path  string       // path in etcd
+	Value string       // raw value in etcd (or the value being written)
+	Type  reflect.Type // type of the field related to the path
+	Err   error        // underlying error
+}
+
+func (e *FieldError) Error() string {
+	if e.Type == nil {
+		return fmt.Sprintf("etcetera: path %s with value %q: %s", e.Path, e.Value, e.Err)
+	}
+
+	return fmt.Sprintf("etcetera: path %s with value %q (%s): %s", e.Path, e.Value, e.Type, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates problems of different paths, so that all of them are reported at once
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the aggregated errors, so errors.Is and errors.As look for a FieldError in all of
+// them (since Go 1.20)
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// add appends an error, flattening it when it is also an aggregation
+func (e Errors) add(err error) Errors {
+	if errs, ok := err.(Errors); ok {
+		return append(e, errs...)
+	}
+
+	return append(e, err)
+}
+
+// err returns the aggregation only when there's something to report
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
 }
 
 type info struct {
 	field   reflect.Value
 	version uint64
+	value   string // raw value of the path in etcd
+	synced  bool   // path was loaded from or saved to etcd
+	loaded  uint64 // etcd index of the response that loaded the path (and its children)
 }
 
 // NewClient internally build a etcd client object (go-etcd library).
@@ -125,6 +275,70 @@ func NewTLSClient(machines []string, cert, key, caCert, namespace string, config
 	return c, nil
 }
 
+// SetHistoryTimeout defines how long LoadAt and LoadFieldAt wait for etcd to return the changes of
+// a path that were made after the requested index. The changes are returned immediately when they
+// exist, so the timeout is only reached when nothing changed in the path since its last change
+// (that is usually what happens). There's no way to distinguish a path without more changes from
+// a slow etcd, so when etcd takes longer than the timeout to answer, the remaining changes are not
+// undone and the returned value is wrong. The timeout must be much higher than the latency of etcd.
+// By default the timeout is 1 second
+func (c *Client) SetHistoryTimeout(timeout time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.historyTimeout = timeout
+}
+
+// SetConcurrency defines the maximum number of requests that are sent to etcd at the same time
+// when saving or loading the configuration. Independent paths are written or read by a pool of go
+// routines, and errors are reported in the same order of the sequential mode. When a request fails
+// no other request is started, but the ones that were already sent at the same time still complete,
+// so a failed save can write more paths than the sequential mode (they are returned with the
+// error). Values lower than 2 disable the concurrency (default)
+func (c *Client) SetConcurrency(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.concurrency = n
+}
+
+// SetStrict defines if the load must fail when there are keys in the etcd namespace that don't
+// match any field of the configuration. The unknown keys are reported with an UnknownKeysError
+func (c *Client) SetStrict(strict bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.strict = strict
+}
+
+// SetBoolAliases defines extra values that are accepted when loading boolean fields, like "yes"
+// or "on". Besides the aliases, all values of strconv.ParseBool are accepted. The aliases are
+// case insensitive
+func (c *Client) SetBoolAliases(aliases map[string]bool) {
+	boolAliases := make(map[string]bool, len(aliases))
+	for alias, value := range aliases {
+		boolAliases[strings.ToLower(alias)] = value
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.boolAliases = boolAliases
+}
+
+// SetLoadMode defines how the configuration is retrieved from etcd. By default each field is
+// retrieved with a different request (LoadFields), so the fields can be from different etcd
+// indexes. With LoadNamespace the configuration is a consistent snapshot of etcd, but fields that
+// don't exist in etcd are ignored instead of returning an error
+func (c *Client) SetLoadMode(mode LoadMode) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.loadMode = mode
+}
+
+// preload maps the paths to the structure fields. The caller must hold the lock when the client is
+// already in use
 func (c *Client) preload(field reflect.Value, prefix string) {
 	field = field.Elem()
 
@@ -155,237 +369,369 @@ func (c *Client) preload(field reflect.Value, prefix string) {
 
 // Save stores a structure in etcd.
 // Only attributes with the tag 'etcd' are going to be saved. Supported types are 'struct', 'slice',
-// 'map', 'string', 'int', 'int64' and 'bool'
-func (c *Client) Save() error {
+// 'map', 'string', 'int', 'int64' and 'bool'. The structure is compared with the last state loaded
+// from or saved to etcd, so only the paths that really changed are written (or removed, when a map
+// key or slice item doesn't exist anymore). The written paths are returned
+func (c *Client) Save() ([]string, error) {
 	namespace := c.namespace
 	if len(namespace) > 0 {
 		namespace = "/" + namespace
 	}
 
-	return c.saveField(c.config, namespace)
+	return c.execute(c.changes(c.config, namespace, c.info))
 }
 
 // SaveField saves a specific field from the configuration structure.
 // Works in the same way of Save, but it can be used to save specific parts of the configuration,
 // avoiding excessive requests to etcd cluster
-func (c *Client) SaveField(field interface{}) error {
+func (c *Client) SaveField(field interface{}) ([]string, error) {
 	path, _, err := c.getInfo(field)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return c.saveField(reflect.ValueOf(field), path)
+	return c.execute(c.changes(reflect.ValueOf(field), path, c.info))
 }
 
-func (c *Client) saveField(field reflect.Value, prefix string) error {
-	if field.Kind() == reflect.Ptr {
-		field = field.Elem()
+// SaveMapEntry saves a specific entry of a map field, identified by the key. Works in the same way
+// of SaveField, but only the entry is compared and written. When the key doesn't exist in the map
+// anymore the entry is removed from etcd
+func (c *Client) SaveMapEntry(field interface{}, key string) ([]string, error) {
+	path, value, err := c.mapEntry(field, key)
+	if err != nil {
+		return nil, err
 	}
 
-	switch field.Kind() {
-	case reflect.Struct:
-		for i := 0; i < field.NumField(); i++ {
-			subfield := field.Field(i)
-			subfieldType := field.Type().Field(i)
-
-			path := normalizeTag(subfieldType.Tag.Get("etcd"))
-			if len(path) == 0 {
-				continue
-			}
-			path = prefix + "/" + path
+	if !value.IsValid() {
+		c.lock.RLock()
+		current := c.info[path]
+		c.lock.RUnlock()
 
-			if err := c.saveField(subfield, path); err != nil {
-				return err
-			}
+		if !current.synced {
+			return nil, nil
 		}
 
-	case reflect.Map:
-		if _, err := c.etcdClient.CreateDir(prefix, 0); err != nil && !alreadyExistsError(err) {
-			return err
-		}
+		return c.execute([]Operation{
+			{Type: OperationDelete, Path: path, OldValue: current.value},
+		})
+	}
 
-		for _, key := range field.MapKeys() {
-			value := field.MapIndex(key)
-			path := prefix + "/" + key.String()
+	if value.Kind() != reflect.Struct {
+		return c.execute(c.changes(value, path, c.info))
+	}
 
-			switch value.Kind() {
-			case reflect.Struct:
-				if err := c.saveField(value, path); err != nil {
-					return err
-				}
+	var operations []Operation
 
-			case reflect.String:
-				if _, err := c.etcdClient.Set(path, value.String(), 0); err != nil {
-					return err
-				}
-			}
+	c.lock.RLock()
+	if !c.info[path].synced {
+		operations = append(operations, Operation{Type: OperationCreateDir, Path: path})
+	}
+	operations = append(operations, c.diff(value, path, c.info)...)
+	c.lock.RUnlock()
+
+	return c.execute(operations)
+}
+
+// SaveSliceElement saves a specific element of a slice field, identified by the index. Works in
+// the same way of SaveField, but only the element is compared and written. An element that doesn't
+// exist in etcd yet can only be saved after all the previous elements
+func (c *Client) SaveSliceElement(field interface{}, index int) ([]string, error) {
+	path, value, created, err := c.sliceElement(field, index)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []Operation
+
+	c.lock.RLock()
+	if value.Kind() == reflect.Struct {
+		if !c.info[path].synced {
+			operations = append(operations, Operation{Type: OperationCreateDir, Path: path})
 		}
+		operations = append(operations, c.diff(value, path, c.info)...)
 
-	case reflect.Slice:
-		if _, err := c.etcdClient.CreateDir(prefix, 0); err != nil && !alreadyExistsError(err) {
-			return err
+	} else if !created {
+		if newValue, ok := formatValue(value); ok {
+			operations = append(operations, Operation{Type: OperationAppend, Path: path, NewValue: newValue})
 		}
 
-		for i := 0; i < field.Len(); i++ {
-			item := field.Index(i)
+	} else {
+		operations = diffValue(value, path, c.info, c.boolAliases)
+	}
+	c.lock.RUnlock()
 
-			if item.Kind() == reflect.Struct {
-				path := fmt.Sprintf("%s/%d", prefix, i)
+	return c.execute(operations)
+}
 
-				if _, err := c.etcdClient.CreateDir(path, 0); err != nil && !alreadyExistsError(err) {
-					return err
-				}
+// MapEntryVersion returns the current version of a map entry retrieved from etcd. It does not
+// query etcd for the latest version. When the entry was not retrieved from etcd yet, the version 0
+// is returned
+func (c *Client) MapEntryVersion(field interface{}, key string) (uint64, error) {
+	path, _, err := c.mapEntry(field, key)
+	if err != nil {
+		return 0, err
+	}
 
-				if err := c.saveField(item, path); err != nil {
-					return err
-				}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 
-			} else {
-				if _, err := c.etcdClient.CreateInOrder(prefix, item.String(), 0); err != nil {
-					return err
-				}
-			}
-		}
+	return c.info[path].version, nil
+}
 
-	case reflect.String:
-		value := field.Interface().(string)
-		if _, err := c.etcdClient.Set(prefix, value, 0); err != nil {
-			return err
-		}
+// SliceElementVersion returns the current version of a slice element retrieved from etcd. It does
+// not query etcd for the latest version. When the element was not retrieved from etcd yet, the
+// version 0 is returned
+func (c *Client) SliceElementVersion(field interface{}, index int) (uint64, error) {
+	path, _, created, err := c.sliceElement(field, index)
+	if err != nil || !created {
+		return 0, err
+	}
 
-	case reflect.Int:
-		value := field.Interface().(int)
-		if _, err := c.etcdClient.Set(prefix, strconv.FormatInt(int64(value), 10), 0); err != nil {
-			return err
-		}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 
-	case reflect.Int64:
-		value := field.Interface().(int64)
-		if _, err := c.etcdClient.Set(prefix, strconv.FormatInt(value, 10), 0); err != nil {
-			return err
-		}
+	return c.info[path].version, nil
+}
 
-	case reflect.Bool:
-		value := field.Interface().(bool)
+// mapEntry returns the path and the value of a map entry. If the key doesn't exist in the map an
+// invalid value is returned
+func (c *Client) mapEntry(field interface{}, key string) (string, reflect.Value, error) {
+	path, info, err := c.getInfo(field)
+	if err != nil {
+		return "", reflect.Value{}, err
+	}
 
-		var valueStr string
-		if value {
-			valueStr = "true"
-		} else {
-			valueStr = "false"
-		}
+	if info.field.Kind() != reflect.Map || info.field.Type().Key().Kind() != reflect.String {
+		return "", reflect.Value{}, ErrInvalidEntry
+	}
 
-		if _, err := c.etcdClient.Set(prefix, valueStr, 0); err != nil {
-			return err
-		}
+	// The map entry is a copy, so it can be used after releasing the lock
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	keyValue := reflect.ValueOf(key).Convert(info.field.Type().Key())
+	return path + "/" + key, info.field.MapIndex(keyValue), nil
+}
+
+// sliceElement returns the path and the value of a slice element. Elements of primitive types are
+// created in order, so the path is only known after they are loaded from or saved to etcd. For
+// elements that weren't created yet the path of the slice is returned and the created flag is false
+func (c *Client) sliceElement(field interface{}, index int) (string, reflect.Value, bool, error) {
+	path, info, err := c.getInfo(field)
+	if err != nil {
+		return "", reflect.Value{}, false, err
 	}
 
-	c.info[prefix] = info{
-		field: field,
+	// Loads replace the slice instead of modifying it, so the element can be used after releasing
+	// the lock
+	c.configLock.RLock()
+	if info.field.Kind() != reflect.Slice || index < 0 || index >= info.field.Len() {
+		c.configLock.RUnlock()
+		return "", reflect.Value{}, false, ErrInvalidEntry
 	}
 
-	return nil
-}
+	value := info.field.Index(index)
+	c.configLock.RUnlock()
 
-func alreadyExistsError(err error) bool {
-	etcderr, ok := err.(*etcd.EtcdError)
-	if !ok {
-		return false
+	if value.Kind() == reflect.Struct {
+		return fmt.Sprintf("%s/%d", path, index), value, true, nil
 	}
 
-	return etcderr.ErrorCode == int(etcdErrorCodeNodeExist)
+	c.lock.RLock()
+	items := children(c.info, path)
+	c.lock.RUnlock()
+
+	if index < len(items) {
+		return items[index], value, true, nil
+
+	} else if index > len(items) {
+		return "", reflect.Value{}, false, ErrInvalidEntry
+	}
+
+	return path, value, false, nil
 }
 
-// Load retrieves the data from the etcd into the given structure.
-// Only attributes with the tag 'etcd' will be filled. Supported types are 'struct', 'slice', 'map',
-// 'string', 'int', 'int64' and 'bool'
-func (c *Client) Load() error {
+// Read executes the function holding a read lock of the configuration, so the configuration fields
+// can be read safely while loads and watches are updating them. The function must not call
+// methods of the client that load the configuration, as they would wait for the lock
+func (c *Client) Read(fn func()) {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	fn()
+}
+
+// changes compares the field with the known state holding the configuration read lock, so the
+// field isn't modified by a watch during the comparison
+func (c *Client) changes(field reflect.Value, prefix string, known map[string]info) []Operation {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.diff(field, prefix, known)
+}
+
+// Pending returns the operations that Save would perform now. As in Save, the structure is compared
+// with the last state loaded from or saved to etcd, and nothing is written, so it can be used as a
+// dry-run before saving. Changes made in etcd by someone else after the last load aren't considered
+// (see Plan)
+func (c *Client) Pending() []Operation {
 	namespace := c.namespace
 	if len(namespace) > 0 {
 		namespace = "/" + namespace
 	}
 
-	return c.load(c.config, namespace)
+	return c.changes(c.config, namespace, c.info)
 }
 
-func (c *Client) load(config reflect.Value, prefix string) error {
-	if config.Kind() != reflect.Ptr {
-		return ErrInvalidConfig
+// PendingField returns the operations that SaveField would perform now for a specific field. Works
+// in the same way of Pending
+func (c *Client) PendingField(field interface{}) ([]Operation, error) {
+	path, _, err := c.getInfo(field)
+	if err != nil {
+		return nil, err
 	}
-	config = config.Elem()
 
-	for i := 0; i < config.NumField(); i++ {
-		field := config.Field(i)
-		fieldType := config.Type().Field(i)
+	return c.changes(reflect.ValueOf(field), path, c.info), nil
+}
 
-		path := normalizeTag(fieldType.Tag.Get("etcd"))
+// Plan returns the differences between the configuration structure and the current state of etcd,
+// as the operations that would make etcd match the structure. Nothing is written. Save doesn't
+// query etcd and compares the structure with the last loaded or saved state instead, so when etcd
+// was changed by someone else after the last load the operations can differ from the ones that
+// Save sends (use Pending to preview them)
+func (c *Client) Plan() ([]Operation, error) {
+	namespace := c.namespace
+	if len(namespace) > 0 {
+		namespace = "/" + namespace
+	}
+
+	var paths []string
+
+	config := c.config.Elem()
+	for i := 0; i < config.NumField(); i++ {
+		path := normalizeTag(config.Type().Field(i).Tag.Get("etcd"))
 		if len(path) == 0 {
 			continue
 		}
-		path = prefix + "/" + path
 
-		response, err := c.etcdClient.Get(path, true, true)
-		if err != nil {
-			return err
-		}
+		paths = append(paths, namespace+"/"+path)
+	}
 
-		if err := c.fillField(field, response.Node, path); err != nil {
-			return err
-		}
+	known, err := c.remoteState(paths...)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return c.changes(c.config, namespace, known), nil
 }
 
-// Watch keeps track of a specific field in etcd using a long polling strategy.
-// When a change is detected the callback function will run. When you want to stop watching the
-// field, just close the returning channel
-//
-// BUG(rafaeljusto): If the user sends a boolean false instead of closing the returning channel, we
-// could have a strange behavior since there are two go routines listening on it (go-etcd and
-// etcetera watch functions)
-func (c *Client) Watch(field interface{}, callback func()) (chan<- bool, error) {
+// PlanField returns the differences between a specific field and the current state of etcd. Works
+// in the same way of Plan, without writing anything in etcd
+func (c *Client) PlanField(field interface{}) ([]Operation, error) {
 	path, _, err := c.getInfo(field)
 	if err != nil {
 		return nil, err
 	}
 
-	fieldValue := reflect.ValueOf(field)
-	if fieldValue.Kind() == reflect.Ptr {
-		fieldValue = fieldValue.Elem()
+	known, err := c.remoteState(path)
+	if err != nil {
+		return nil, err
 	}
 
-	stop := make(chan bool)
-	receiver := make(chan *etcd.Response)
+	return c.changes(reflect.ValueOf(field), path, known), nil
+}
 
-	// We are always retrieving the last version (index) of the path
-	go c.etcdClient.Watch(path, 0, true, receiver, stop)
+// remoteState retrieves the current state of the paths from etcd in the same format that we store
+// the loaded or saved state. Paths that don't exist in etcd are ignored
+func (c *Client) remoteState(paths ...string) (map[string]info, error) {
+	known := make(map[string]info)
+
+	var walk func(node *etcd.Node)
+	walk = func(node *etcd.Node) {
+		known[node.Key] = info{
+			version: node.ModifiedIndex,
+			value:   node.Value,
+			synced:  true,
+		}
 
-	go func() {
-		for {
-			select {
-			case response := <-receiver:
-				if response != nil {
-					// When watching a directory (slice, map or structure) the response will be from the node
-					// that changed and not the entire directory. So we need to query the directory again with
-					// recursion to load it correctly.
-					response, err := c.etcdClient.Get(path, true, true)
-					if err == nil {
-						c.fillField(fieldValue, response.Node, path)
-						callback()
-					}
-				}
+		for _, child := range node.Nodes {
+			walk(child)
+		}
+	}
 
-			case <-stop:
-				return
-			}
+	for _, path := range paths {
+		response, err := c.etcdClient.Get(path, true, true)
+		if notFoundError(err) {
+			continue
+
+		} else if err != nil {
+			return nil, err
 		}
-	}()
 
-	return stop, nil
+		walk(response.Node)
+	}
+
+	return known, nil
+}
+
+// Operation is a single request that needs to be sent to etcd so that a path reflects the
+// configuration structure. The old value is the one known before the operation (empty when the
+// path doesn't exist), and the new value is the one that is going to be written
+type Operation struct {
+	Type     OperationType `json:"type"`
+	Path     string        `json:"path"`
+	OldValue string        `json:"oldValue,omitempty"`
+	NewValue string        `json:"newValue,omitempty"`
+
+	field reflect.Value
+}
+
+// String describes the operation in a human readable format
+func (o Operation) String() string {
+	switch o.Type {
+	case OperationSet:
+		return fmt.Sprintf("%s %s: %q => %q", o.Type, o.Path, o.OldValue, o.NewValue)
+
+	case OperationAppend:
+		return fmt.Sprintf("%s %s: %q", o.Type, o.Path, o.NewValue)
+
+	case OperationDelete:
+		if len(o.OldValue) > 0 {
+			return fmt.Sprintf("%s %s: %q", o.Type, o.Path, o.OldValue)
+		}
+	}
+
+	return fmt.Sprintf("%s %s", o.Type, o.Path)
 }
 
-func (c *Client) fillField(field reflect.Value, node *etcd.Node, prefix string) error {
+// OperationType identifies what kind of request an operation sends to etcd
+type OperationType string
+
+// List of possible operations sent to etcd when saving the configuration
+const (
+	OperationCreateDir OperationType = "createDir" // creates a directory for a map or slice
+	OperationSet       OperationType = "set"       // creates or replaces the value of a key
+	OperationAppend    OperationType = "append"    // creates a new item at the end of a slice
+	OperationDelete    OperationType = "delete"    // removes a key or directory recursively
+)
+
+// diff compares a field with the known state of etcd and returns the operations necessary to
+// synchronize them. The known state is a map of paths to information retrieved from etcd, where
+// only the synchronized entries are taken into account
+func (c *Client) diff(field reflect.Value, prefix string, known map[string]info) []Operation {
+	if field.Kind() == reflect.Ptr {
+		field = field.Elem()
+	}
+
+	if holder, ok := holderOf(field); ok {
+		return c.diff(holder.reflectValue(), prefix, known)
+	}
+
+	var operations []Operation
+
 	switch field.Kind() {
 	case reflect.Struct:
 		for i := 0; i < field.NumField(); i++ {
@@ -398,25 +744,2045 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, prefix string)
 			}
 			path = prefix + "/" + path
 
-			for _, child := range node.Nodes {
-				if path == child.Key {
-					if err := c.fillField(subfield, child, path); err != nil {
-						return err
-					}
-					break
-				}
-			}
+			operations = append(operations, c.diff(subfield, path, known)...)
 		}
 
 	case reflect.Map:
-		field.Set(reflect.MakeMap(field.Type()))
+		if !known[prefix].synced {
+			operations = append(operations, Operation{Type: OperationCreateDir, Path: prefix, field: field})
+		}
 
-		switch field.Type().Elem().Kind() {
-		case reflect.Struct:
+		keys := field.MapKeys()
+		sort.Sort(byString(keys))
+
+		current := make(map[string]bool)
+		for _, key := range keys {
+			value := field.MapIndex(key)
+			path := prefix + "/" + key.String()
+			current[path] = true
+
+			switch value.Kind() {
+			case reflect.Struct:
+				// The directory of the entry is recorded, so that a removed entry is detected later
+				if !known[path].synced {
+					operations = append(operations, Operation{Type: OperationCreateDir, Path: path})
+				}
+				operations = append(operations, c.diff(value, path, known)...)
+
+			case reflect.String:
+				operations = append(operations, diffValue(value, path, known, c.boolAliases)...)
+			}
+		}
+
+		for _, path := range children(known, prefix) {
+			if !current[path] {
+				operations = append(operations, Operation{Type: OperationDelete, Path: path, OldValue: known[path].value})
+			}
+		}
+
+	case reflect.Slice:
+		if !known[prefix].synced {
+			operations = append(operations, Operation{Type: OperationCreateDir, Path: prefix, field: field})
+		}
+
+		if field.Type().Elem().Kind() == reflect.Struct {
+			for i := 0; i < field.Len(); i++ {
+				path := fmt.Sprintf("%s/%d", prefix, i)
+
+				if !known[path].synced {
+					operations = append(operations, Operation{Type: OperationCreateDir, Path: path})
+				}
+
+				operations = append(operations, c.diff(field.Index(i), path, known)...)
+			}
+
+			for _, path := range children(known, prefix) {
+				index, err := strconv.Atoi(path[len(prefix)+1:])
+				if err != nil || index >= field.Len() {
+					operations = append(operations, Operation{Type: OperationDelete, Path: path, OldValue: known[path].value})
+				}
+			}
+
+		} else {
+			// Slice items are created in order, so we don't know the path of the new items. Items
+			// that already exist are replaced in place
+			items := children(known, prefix)
+
+			for i := 0; i < field.Len(); i++ {
+				value, ok := formatValue(field.Index(i))
+				if !ok {
+					continue
+				}
+
+				if i < len(items) {
+					if !sameValue(field.Type().Elem(), known[items[i]].value, value, c.boolAliases) {
+						operations = append(operations, Operation{
+							Type:     OperationSet,
+							Path:     items[i],
+							OldValue: known[items[i]].value,
+							NewValue: value,
+						})
+					}
+
+				} else {
+					operations = append(operations, Operation{Type: OperationAppend, Path: prefix, NewValue: value})
+				}
+			}
+
+			for i := field.Len(); i < len(items); i++ {
+				operations = append(operations, Operation{Type: OperationDelete, Path: items[i], OldValue: known[items[i]].value})
+			}
+		}
+
+	default:
+		operations = append(operations, diffValue(field, prefix, known, c.boolAliases)...)
+	}
+
+	return operations
+}
+
+// diffValue checks if a primitive value is different from the known state of the path
+func diffValue(field reflect.Value, path string, known map[string]info, aliases map[string]bool) []Operation {
+	value, ok := formatValue(field)
+	if !ok {
+		return nil
+	}
+
+	current := known[path]
+	if current.synced && sameValue(field.Type(), current.value, value, aliases) {
+		return nil
+	}
+
+	return []Operation{
+		{Type: OperationSet, Path: path, OldValue: current.value, NewValue: value, field: field},
+	}
+}
+
+// sameValue checks if the raw value of etcd represents the formatted value. Values written manually
+// in etcd can be in other formats, like "yes", "007" or "1m30s", and they must not be replaced when
+// nothing changed
+func sameValue(t reflect.Type, raw, value string, aliases map[string]bool) bool {
+	if raw == value {
+		return true
+	}
+
+	parsed, err := parseValue(t, raw, aliases)
+	if err != nil || !parsed.IsValid() {
+		return false
+	}
+
+	formatted, _ := formatValue(parsed)
+	return formatted == value
+}
+
+// execute sends the operations to etcd, stopping in the first error. The paths that were written
+// are returned, and the client state is updated so that the next save only writes new changes.
+// When the client allows concurrent requests, independent operations are sent at the same time,
+// and the ones that were running when another failed are also written. The written paths and the
+// returned error still follow the order of the operations
+func (c *Client) execute(operations []Operation) ([]string, error) {
+	responses := make([]*etcd.Response, len(operations))
+	errs := make([]error, len(operations))
+	sent := make([]bool, len(operations))
+
+	for _, batch := range c.batches(operations) {
+		tasks := make([]func() error, len(batch))
+		for i, group := range batch {
+			group := group
+
+			tasks[i] = func() error {
+				for _, index := range group {
+					responses[index], errs[index] = c.send(operations[index])
+					sent[index] = true
+
+					if errs[index] != nil {
+						return errs[index]
+					}
+				}
+				return nil
+			}
+		}
+
+		if err := c.parallel(tasks); err != nil {
+			break
+		}
+	}
+
+	var written []string
+	var firstErr error
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, op := range operations {
+		if !sent[i] {
+			continue
+
+		} else if errs[i] != nil {
+			if firstErr == nil {
+				fieldErr := &FieldError{Path: op.Path, Value: op.NewValue, Err: errs[i]}
+				if op.field.IsValid() {
+					fieldErr.Type = op.field.Type()
+				}
+				firstErr = fieldErr
+			}
+			continue
+		}
+
+		path := op.Path
+
+		var version uint64
+		if responses[i] != nil && responses[i].Node != nil {
+			version = responses[i].Node.ModifiedIndex
+
+			if op.Type == OperationAppend {
+				path = responses[i].Node.Key
+			}
+		}
+
+		if op.Type == OperationDelete {
+			forget(c.info, path)
+		} else {
+			record(c.info, path, op.field, op.NewValue, version)
+		}
+
+		written = append(written, path)
+	}
+
+	return written, firstErr
+}
+
+// send performs the request of a single operation in etcd. Errors informing that a directory
+// already exists or that a removed path doesn't exist are ignored
+func (c *Client) send(op Operation) (response *etcd.Response, err error) {
+	switch op.Type {
+	case OperationCreateDir:
+		if response, err = c.etcdClient.CreateDir(op.Path, 0); alreadyExistsError(err) {
+			err = nil
+		}
+
+	case OperationSet:
+		response, err = c.etcdClient.Set(op.Path, op.NewValue, 0)
+
+	case OperationAppend:
+		response, err = c.etcdClient.CreateInOrder(op.Path, op.NewValue, 0)
+
+	case OperationDelete:
+		if response, err = c.etcdClient.Delete(op.Path, true); notFoundError(err) {
+			err = nil
+		}
+	}
+
+	return
+}
+
+// batches groups the operations (by index) in a sequence of batches. Groups of the same batch are
+// independent and can be sent at the same time, while the operations inside a group must be sent
+// in order. Without concurrency there's a single batch, and each operation is a group
+func (c *Client) batches(operations []Operation) [][][]int {
+	c.lock.RLock()
+	concurrency := c.concurrency
+	c.lock.RUnlock()
+
+	if concurrency < 2 {
+		var batch [][]int
+		for i := range operations {
+			batch = append(batch, []int{i})
+		}
+		return [][][]int{batch}
+	}
+
+	var deletes [][]int
+	dirs := make(map[int][][]int)
+	var depths []int
+	var writes [][]int
+	appends := make(map[string]int)
+
+	for i, op := range operations {
+		switch op.Type {
+		case OperationDelete:
+			deletes = append(deletes, []int{i})
+
+		case OperationCreateDir:
+			// Parent directories must exist before the children directories
+			depth := strings.Count(op.Path, "/")
+			if _, ok := dirs[depth]; !ok {
+				depths = append(depths, depth)
+			}
+			dirs[depth] = append(dirs[depth], []int{i})
+
+		case OperationSet:
+			writes = append(writes, []int{i})
+
+		case OperationAppend:
+			// Items of the same slice must be created in order
+			if group, ok := appends[op.Path]; ok {
+				writes[group] = append(writes[group], i)
+			} else {
+				appends[op.Path] = len(writes)
+				writes = append(writes, []int{i})
+			}
+		}
+	}
+
+	sort.Ints(depths)
+
+	batches := [][][]int{deletes}
+	for _, depth := range depths {
+		batches = append(batches, dirs[depth])
+	}
+	return append(batches, writes)
+}
+
+// parallel runs the tasks with at most the number of concurrent requests allowed by the client.
+// Without concurrency the tasks run in order until the first error. With concurrency the tasks
+// after a failed one (in the given order) that didn't start yet are skipped, but the ones that were
+// already running are completed. The returned error is the one from the first task (in the given
+// order) that failed, as in the sequential mode
+func (c *Client) parallel(tasks []func() error) error {
+	c.lock.RLock()
+	concurrency := c.concurrency
+	c.lock.RUnlock()
+
+	if concurrency < 2 {
+		for _, task := range tasks {
+			if err := task(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(tasks))
+	queue := make(chan int)
+	failed := make(chan struct{})
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	firstFailed := len(tasks)
+
+	for i := 0; i < concurrency && i < len(tasks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				lock.Lock()
+				skip := index > firstFailed
+				lock.Unlock()
+
+				if skip {
+					continue
+				}
+
+				if errs[index] = tasks[index](); errs[index] != nil {
+					lock.Lock()
+					if firstFailed == len(tasks) {
+						close(failed)
+					}
+					if index < firstFailed {
+						firstFailed = index
+					}
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+
+QueueLoop:
+	for i := range tasks {
+		select {
+		case queue <- i:
+		case <-failed:
+			break QueueLoop
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record stores the state of a path that is synchronized with etcd. If the field isn't addressable
+// we keep the field that was previously mapped to the path (if any)
+func record(known map[string]info, path string, field reflect.Value, value string, version uint64) {
+	i := known[path]
+	if field.IsValid() && field.CanAddr() {
+		i.field = field
+	}
+
+	i.value = value
+	i.version = version
+	i.synced = true
+	known[path] = i
+}
+
+// loadedAt stores the etcd index of the response that loaded the path, so a watch of the path (or
+// of its children) can start right after it
+func loadedAt(known map[string]info, path string, index uint64) {
+	i := known[path]
+	i.loaded = index
+	known[path] = i
+}
+
+// forget discards the etcd state of the path and all its children, keeping only the mapping of the
+// structure fields
+func forget(known map[string]info, path string) {
+	for p, i := range known {
+		if p != path && !strings.HasPrefix(p, path+"/") {
+			continue
+		}
+
+		if i.field.IsValid() {
+			known[p] = info{field: i.field}
+		} else {
+			delete(known, p)
+		}
+	}
+}
+
+// children returns the synchronized paths that are directly under the given path, sorted in the
+// same way that etcd sorts them
+func children(known map[string]info, prefix string) []string {
+	var paths []string
+	for path, info := range known {
+		if !info.synced || !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+
+		if strings.Contains(path[len(prefix)+1:], "/") {
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// formatValue converts a primitive value to the format stored in etcd. If the type isn't supported
+// false is returned
+func formatValue(field reflect.Value) (string, bool) {
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), true
+
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), true
+
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), true
+	}
+
+	return "", false
+}
+
+// byString sorts map keys so that the operations are always generated in the same order
+type byString []reflect.Value
+
+func (b byString) Len() int           { return len(b) }
+func (b byString) Less(i, j int) bool { return b[i].String() < b[j].String() }
+func (b byString) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// byIndex sorts the nodes of a slice of structures by the numeric index in the end of the key
+type byIndex etcd.Nodes
+
+func (b byIndex) Len() int      { return len(b) }
+func (b byIndex) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byIndex) Less(i, j int) bool {
+	return nodeIndex(b[i]) < nodeIndex(b[j])
+}
+
+func nodeIndex(node *etcd.Node) int {
+	index, err := strconv.Atoi(node.Key[strings.LastIndex(node.Key, "/")+1:])
+	if err != nil {
+		return -1
+	}
+	return index
+}
+
+func alreadyExistsError(err error) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	if !ok {
+		return false
+	}
+
+	return etcderr.ErrorCode == int(etcdErrorCodeNodeExist)
+}
+
+func notFoundError(err error) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	if !ok {
+		return false
+	}
+
+	return etcderr.ErrorCode == int(etcdErrorCodeKeyNotFound)
+}
+
+// indexClearedError checks if etcd doesn't have the events of the requested index in the history
+// anymore
+func indexClearedError(err error) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	if !ok {
+		return false
+	}
+
+	return etcderr.ErrorCode == int(etcdErrorCodeEventIndexCleared)
+}
+
+// Load retrieves the data from the etcd into the given structure.
+// Only attributes with the tag 'etcd' will be filled. Supported types are 'struct', 'slice', 'map',
+// 'string', 'int', 'int64' and 'bool'. The data is decoded into a copy of the fields, and the
+// configuration is only modified when all fields were loaded without errors
+func (c *Client) Load() error {
+	namespace := c.namespace
+	if len(namespace) > 0 {
+		namespace = "/" + namespace
+	}
+
+	return c.load(c.config, namespace)
+}
+
+func (c *Client) load(config reflect.Value, prefix string) error {
+	if config.Kind() != reflect.Ptr {
+		return ErrInvalidConfig
+	}
+	config = config.Elem()
+
+	var fields []reflect.Value
+	var paths, defaults []string
+
+	for i := 0; i < config.NumField(); i++ {
+		field := config.Field(i)
+		fieldType := config.Type().Field(i)
+
+		path := normalizeTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+
+		fields = append(fields, field)
+		paths = append(paths, prefix+"/"+path)
+		defaults = append(defaults, fieldType.Tag.Get("default"))
+	}
+
+	c.lock.RLock()
+	loadMode, strict := c.loadMode, c.strict
+	c.lock.RUnlock()
+
+	if loadMode == LoadNamespace {
+		return c.loadNamespace(fields, paths, defaults, prefix, strict)
+	}
+
+	if strict {
+		unknown, err := c.Lint()
+		if err != nil {
+			return err
+		}
+
+		if len(unknown) > 0 {
+			return &UnknownKeysError{Keys: unknown}
+		}
+	}
+
+	responses := make([]*etcd.Response, len(paths))
+	tasks := make([]func() error, len(paths))
+
+	for i, path := range paths {
+		i, path := i, path
+
+		tasks[i] = func() (err error) {
+			responses[i], err = c.etcdClient.Get(path, true, true)
+			if notFoundError(err) && hasDefault(fields[i].Type(), defaults[i]) {
+				// the missing field is filled with the defaults
+				responses[i] = &etcd.Response{EtcdIndex: err.(*etcd.EtcdError).Index}
+
+			} else if err != nil {
+				return &FieldError{Path: path, Type: fields[i].Type(), Err: err}
+			}
+			return nil
+		}
+	}
+
+	if err := c.parallel(tasks); err != nil {
+		return err
+	}
+
+	var errs Errors
+	var index uint64
+
+	shadows := c.shadows(fields)
+	staged := make(map[string]info)
+
+	for i := range fields {
+		if responses[i].Node == nil {
+			shadows[i] = reflect.New(fields[i].Type()).Elem()
+			if err := c.fillDefault(shadows[i], paths[i], defaults[i]); err != nil {
+				errs = errs.add(err)
+			}
+
+		} else if err := c.fillField(shadows[i], responses[i].Node, paths[i], staged); err != nil {
+			errs = errs.add(err)
+		}
+
+		loadedAt(staged, paths[i], responses[i].EtcdIndex)
+
+		if responses[i].EtcdIndex > index {
+			index = responses[i].EtcdIndex
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	changed := c.commit(fields, shadows, paths, staged)
+
+	c.lock.Lock()
+	c.index = index
+	c.lock.Unlock()
+
+	c.publish(index)
+	notify(changed)
+	return nil
+}
+
+// loadNamespace retrieves the namespace directory with a single request and fill the fields with
+// the children nodes. Missing fields are filled with the defaults
+func (c *Client) loadNamespace(fields []reflect.Value, paths, defaults []string, prefix string, strict bool) error {
+	root := prefix
+	if len(root) == 0 {
+		root = "/"
+	}
+
+	response, err := c.etcdClient.Get(root, true, true)
+	if err != nil {
+		return &FieldError{Path: root, Type: c.config.Elem().Type(), Err: err}
+	}
+
+	if strict {
+		if unknown := unknownKeys(c.config.Elem().Type(), response.Node, prefix); len(unknown) > 0 {
+			return &UnknownKeysError{Keys: unknown}
+		}
+	}
+
+	var errs Errors
+
+	shadows := c.shadows(fields)
+	staged := make(map[string]info)
+
+	for i := range fields {
+		found := false
+		for _, child := range response.Node.Nodes {
+			if child.Key != paths[i] {
+				continue
+			}
+
+			if err := c.fillField(shadows[i], child, paths[i], staged); err != nil {
+				errs = errs.add(err)
+			}
+
+			found = true
+			break
+		}
+
+		if !found && hasDefault(fields[i].Type(), defaults[i]) {
+			shadows[i] = reflect.New(fields[i].Type()).Elem()
+			if err := c.fillDefault(shadows[i], paths[i], defaults[i]); err != nil {
+				errs = errs.add(err)
+			}
+		}
+
+		loadedAt(staged, paths[i], response.EtcdIndex)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	changed := c.commit(fields, shadows, paths, staged)
+
+	c.lock.Lock()
+	c.index = response.EtcdIndex
+	c.lock.Unlock()
+
+	c.publish(response.EtcdIndex)
+	notify(changed)
+	return nil
+}
+
+// shadow returns a copy of the field that can be filled without affecting the configuration. Maps
+// and slices are replaced (not modified) when filled, so a shallow copy is enough. Value fields are
+// left empty, and only the filled ones are assigned when committing
+func shadow(field reflect.Value) reflect.Value {
+	copied := reflect.New(field.Type()).Elem()
+	copyField(copied, field)
+	return copied
+}
+
+// shadows returns the shadows of the configuration fields holding the configuration read lock
+func (c *Client) shadows(fields []reflect.Value) []reflect.Value {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	shadows := make([]reflect.Value, len(fields))
+	for i, field := range fields {
+		shadows[i] = shadow(field)
+	}
+
+	return shadows
+}
+
+// commit copies the filled shadows to the configuration fields, and replaces the state of the
+// fields paths with the staged state, keeping the mapping of the configuration fields. Only called
+// when all shadows were filled without errors, so the configuration is never partially updated.
+// The Value fields that changed are returned to be notified
+func (c *Client) commit(fields, shadows []reflect.Value, paths []string, staged map[string]info) []valueHolder {
+	var changed []valueHolder
+
+	c.configLock.Lock()
+	for i, field := range fields {
+		changed = append(changed, assign(field, shadows[i])...)
+	}
+	c.configLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, field := range fields {
+		forget(c.info, paths[i])
+		c.preload(field.Addr(), paths[i])
+	}
+
+	for path, i := range staged {
+		if current, ok := c.info[path]; ok && current.field.IsValid() {
+			i.field = current.field
+		}
+
+		c.info[path] = i
+	}
+
+	return changed
+}
+
+// notify calls the subscribers of the Value fields that changed. Subscribers could use the client,
+// so they are notified after the commit, without holding any lock
+func notify(changed []valueHolder) {
+	for _, holder := range changed {
+		holder.notify()
+	}
+}
+
+// Lint looks for keys in the etcd namespace that don't match any field of the configuration. This
+// is useful to detect typos in keys that were created manually, as they are ignored when loading
+func (c *Client) Lint() ([]string, error) {
+	prefix := c.namespace
+	if len(prefix) > 0 {
+		prefix = "/" + prefix
+	}
+
+	root := prefix
+	if len(root) == 0 {
+		root = "/"
+	}
+
+	response, err := c.etcdClient.Get(root, true, true)
+	if notFoundError(err) {
+		return nil, nil
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	return unknownKeys(c.config.Elem().Type(), response.Node, prefix), nil
+}
+
+// unknownKeys walks the etcd node looking for children that don't match the given type
+func unknownKeys(t reflect.Type, node *etcd.Node, prefix string) []string {
+	var unknown []string
+	t = holderType(t)
+
+	switch t.Kind() {
+	case reflect.Struct:
+	ChildLoop:
+		for _, child := range node.Nodes {
+			for i := 0; i < t.NumField(); i++ {
+				path := normalizeTag(t.Field(i).Tag.Get("etcd"))
+				if len(path) == 0 {
+					continue
+				}
+
+				if prefix+"/"+path == child.Key {
+					unknown = append(unknown, unknownKeys(t.Field(i).Type, child, child.Key)...)
+					continue ChildLoop
+				}
+			}
+
+			unknown = append(unknown, child.Key)
+		}
+
+	case reflect.Map, reflect.Slice:
+		for _, child := range node.Nodes {
+			unknown = append(unknown, unknownKeys(t.Elem(), child, child.Key)...)
+		}
+
+	default:
+		// Primitive types can't have children
+		for _, child := range node.Nodes {
+			unknown = append(unknown, child.Key)
+		}
+	}
+
+	return unknown
+}
+
+// LoadField retrieves a specific field of the configuration structure from etcd.
+// Works in the same way of Load, but it can be used to refresh specific parts of the configuration,
+// avoiding excessive requests to etcd cluster
+func (c *Client) LoadField(field interface{}) error {
+	path, _, err := c.getInfo(field)
+	if err != nil {
+		return err
+	}
+
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+	}
+
+	_, err = c.loadField(fieldValue, path, nil)
+	return err
+}
+
+// loadField retrieves the field from etcd, returning the etcd index of the response. When there's
+// an approval function, the new value is only copied to the field after it's approved
+func (c *Client) loadField(field reflect.Value, path string, approve Approval) (uint64, error) {
+	staged := make(map[string]info)
+
+	shadow, index, err := c.fetch(field, path, staged)
+	if err == nil {
+		err = check(approve, field, path, shadow)
+	}
+
+	if err != nil {
+		return index, err
+	}
+
+	changed := c.commit([]reflect.Value{field}, []reflect.Value{shadow}, []string{path}, staged)
+	c.publish(index)
+	notify(changed)
+	return index, nil
+}
+
+// fetch retrieves the field from etcd and fills a shadow of it, without changing the configuration.
+// The state of the filled paths is stored in the staged map. The etcd index of the response is
+// returned even when the field cannot be filled. A missing field is filled with its defaults, when
+// it has any
+func (c *Client) fetch(field reflect.Value, path string, staged map[string]info) (reflect.Value, uint64, error) {
+	root := path
+	if len(root) == 0 {
+		root = "/"
+	}
+
+	response, err := c.etcdClient.Get(root, true, true)
+	if notFoundError(err) && hasDefault(field.Type(), c.defaultOf(path)) {
+		// the missing field is filled with the defaults
+		index := err.(*etcd.EtcdError).Index
+		loadedAt(staged, path, index)
+
+		shadow, err := c.reset(field, path)
+		return shadow, index, err
+
+	} else if err != nil {
+		return reflect.Value{}, 0, &FieldError{Path: root, Type: field.Type(), Err: err}
+	}
+
+	shadow := c.shadows([]reflect.Value{field})[0]
+	if err := c.fillField(shadow, response.Node, path, staged); err != nil {
+		return reflect.Value{}, response.EtcdIndex, err
+	}
+
+	loadedAt(staged, path, response.EtcdIndex)
+
+	return shadow, response.EtcdIndex, nil
+}
+
+// LoadAt retrieves the configuration as it was in a past etcd index. The data is stored in the given
+// target, that must be a pointer to a structure of the same type of the configuration, so the
+// managed configuration and the versions are not modified. Fields that didn't exist in the index are
+// left untouched. The changes made after the index are undone using the etcd events history (watch
+// from index), so etcd must still have the events in the history. The children of removed
+// directories cannot be recovered. The whole namespace is rebuilt at once, so the history timeout
+// (see SetHistoryTimeout) is waited only once
+func (c *Client) LoadAt(target interface{}, index uint64) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.Elem().Type() != c.config.Elem().Type() {
+		return ErrInvalidTarget
+	}
+	targetValue = targetValue.Elem()
+
+	namespace := c.namespace
+	if len(namespace) > 0 {
+		namespace = "/" + namespace
+	}
+
+	root, err := c.history(namespace, index)
+	if notFoundError(err) {
+		return nil
+
+	} else if err != nil {
+		return err
+	}
+
+	// The target is only modified when all fields were retrieved
+	targetShadow := shadow(targetValue)
+
+	for i := 0; i < targetShadow.NumField(); i++ {
+		field := targetShadow.Field(i)
+		fieldType := targetShadow.Type().Field(i)
+
+		path := normalizeTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+		path = namespace + "/" + path
+
+		for _, child := range root.Nodes {
+			if child.Key != path {
+				continue
+			}
+
+			if err := c.fillField(field, child, path, make(map[string]info)); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	notify(assign(targetValue, targetShadow))
+	return nil
+}
+
+// LoadFieldAt retrieves a specific field as it was in a past etcd index. The data is stored in the
+// given target, that must be a pointer to a value of the same type of the field. Works in the same
+// way of LoadAt
+func (c *Client) LoadFieldAt(field interface{}, index uint64, target interface{}) error {
+	path, fieldInfo, err := c.getInfo(field)
+	if err != nil {
+		return err
+	}
+
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.Elem().Type() != fieldInfo.field.Type() {
+		return ErrInvalidTarget
+	}
+
+	node, err := c.history(path, index)
+	if err != nil {
+		return err
+	}
+
+	targetShadow := shadow(targetValue.Elem())
+	if err := c.fillField(targetShadow, node, path, make(map[string]info)); err != nil {
+		return err
+	}
+
+	notify(assign(targetValue.Elem(), targetShadow))
+	return nil
+}
+
+// history rebuilds the node of a path as it was in a past etcd index. The current state of the path
+// is retrieved, and the changes made after the index are undone using the previous values of the
+// events, replayed with a watch from the index until the etcd index of the current state. Removed
+// keys can have changes after the last change of the current keys, but a watch after that would
+// block waiting for new events when there's nothing else to replay, so it's stopped after the
+// history timeout. An empty path is the root directory
+func (c *Client) history(path string, index uint64) (*etcd.Node, error) {
+	nodes := make(map[string]*etcd.Node)
+	var last, current uint64
+
+	root := path
+	if len(root) == 0 {
+		root = "/"
+	}
+
+	response, err := c.etcdClient.Get(root, true, true)
+	if notFoundError(err) {
+		current = err.(*etcd.EtcdError).Index
+
+	} else if err != nil {
+		return nil, err
+
+	} else {
+		current = response.EtcdIndex
+	}
+
+	c.lock.RLock()
+	timeout := c.historyTimeout
+	c.lock.RUnlock()
+
+	if timeout <= 0 {
+		timeout = defaultHistoryTimeout
+	}
+
+	var walk func(node *etcd.Node)
+	walk = func(node *etcd.Node) {
+		n := *node
+		n.Nodes = nil
+		nodes[n.Key] = &n
+
+		if n.ModifiedIndex > last {
+			last = n.ModifiedIndex
+		}
+
+		for _, child := range node.Nodes {
+			walk(child)
+		}
+	}
+
+	if err == nil {
+		walk(response.Node)
+	}
+
+	undone := make(map[string]bool)
+	for waitIndex := index + 1; waitIndex <= current; {
+		// Until the last change of the current keys there's always an event to replay
+		var stop chan bool
+		var timer *time.Timer
+
+		if waitIndex > last {
+			stop = make(chan bool)
+			timer = time.AfterFunc(timeout, func() {
+				close(stop)
+			})
+		}
+
+		event, err := c.etcdClient.Watch(root, waitIndex, true, nil, stop)
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err == etcd.ErrWatchStoppedByUser {
+			break
+
+		} else if err != nil {
+			return nil, err
+
+		} else if event.Node.ModifiedIndex > current {
+			// changes made after we retrieved the current state are not undone
+			break
+		}
+
+		// Only the first change after the index matters, as it stores the value in the index
+		if key := event.Node.Key; !undone[key] {
+			undone[key] = true
+
+			if event.PrevNode == nil {
+				for k := range nodes {
+					if k == key || strings.HasPrefix(k, key+"/") {
+						delete(nodes, k)
+					}
+				}
+
+			} else {
+				n := *event.PrevNode
+				n.Nodes = nil
+				nodes[key] = &n
+			}
+		}
+
+		waitIndex = event.Node.ModifiedIndex + 1
+	}
+
+	node, ok := nodes[path]
+	if !ok {
+		return nil, &etcd.EtcdError{
+			ErrorCode: int(etcdErrorCodeKeyNotFound),
+			Message:   "Key not found",
+			Cause:     path,
+			Index:     index,
+		}
+	}
+
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == path {
+			continue
+		}
+
+		if parent, ok := nodes[key[:strings.LastIndex(key, "/")]]; ok {
+			parent.Nodes = append(parent.Nodes, nodes[key])
+		}
+	}
+
+	return node, nil
+}
+
+// Index returns the etcd index of the last load. When the configuration is loaded with the
+// LoadNamespace mode, all fields reflect the state of etcd in this index. Otherwise it is the
+// highest index of all requests sent while loading
+func (c *Client) Index() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.index
+}
+
+// Event describes a change detected in a watched field
+type Event struct {
+	Path     string      // etcd path that changed, that can be the watched path or a path under it
+	Action   string      // etcd action, like "set", "create", "update", "delete" or "expire"
+	OldValue string      // raw value before the change
+	NewValue string      // raw value after the change
+	Version  uint64      // new version (etcd index) of the path
+	Field    interface{} // pointer to the configuration field of the path, or to the closest parent
+	Paths    []string    // all paths that changed, more than one when the changes were coalesced
+
+	// When the field is a map or a slice, the keys (or indexes) that were added, removed or modified,
+	// compared with the value before the change
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// newEvent builds the event of an etcd watch response. The watched field is the starting point to
+// look for the field of the path
+func newEvent(response *etcd.Response, field reflect.Value, path string) Event {
+	event := Event{
+		Action: response.Action,
+		Field:  field.Addr().Interface(),
+	}
+
+	if response.Node != nil {
+		event.Path = response.Node.Key
+		event.NewValue = response.Node.Value
+		event.Version = response.Node.ModifiedIndex
+		event.Paths = []string{response.Node.Key}
+	}
+
+	if response.PrevNode != nil {
+		event.OldValue = response.PrevNode.Value
+	}
+
+	field, _ = locate(field, path, event.Path)
+	event.Field = field.Addr().Interface()
+	return event
+}
+
+// locate looks for the deepest structure field of the key, starting from the given field and path.
+// Map entries and slice items aren't addressable, so the map or slice field is returned for them.
+// When the key doesn't belong to any field, the closest structure is returned
+func locate(field reflect.Value, path, key string) (reflect.Value, string) {
+	for field.Kind() == reflect.Struct && strings.HasPrefix(key, path+"/") {
+		if _, ok := holderOf(field); ok {
+			break
+		}
+
+		found := false
+		for i := 0; i < field.NumField(); i++ {
+			tag := normalizeTag(field.Type().Field(i).Tag.Get("etcd"))
+			if len(tag) == 0 {
+				continue
+			}
+
+			subpath := path + "/" + tag
+			if key == subpath || strings.HasPrefix(key, subpath+"/") {
+				field, path, found = field.Field(i), subpath, true
+				break
+			}
+		}
+
+		if !found {
+			break
+		}
+	}
+
+	return field, path
+}
+
+// EventReload is the action of the events sent after a watch is re-established. The field is
+// loaded again, as changes could have been lost while the watch was down
+const EventReload = "reload"
+
+// errWatchClosed is reported when etcd closes the watch without an error
+var errWatchClosed = errors.New("etcetera: watch closed by etcd")
+
+// WatchOption changes the default behavior of a watch
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	errorHandler func(error)
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	debounce     time.Duration
+	buffer       int
+	overflow     OverflowPolicy
+	approve      Approval
+}
+
+// WithErrorHandler defines a function that receives the errors of the watch, like a connection
+// problem with etcd or a new value that cannot be loaded into the field. The function runs in the
+// go routine of the watch
+func WithErrorHandler(handler func(error)) WatchOption {
+	return func(options *watchOptions) {
+		options.errorHandler = handler
+	}
+}
+
+// WithBackoff defines the interval between the attempts to re-establish a watch that failed. The
+// interval starts with the minimum value, and is doubled after each failure up to the maximum
+// value. By default the interval goes from 1 second to 30 seconds
+func WithBackoff(min, max time.Duration) WatchOption {
+	return func(options *watchOptions) {
+		options.minBackoff = min
+		options.maxBackoff = max
+	}
+}
+
+// WithDebounce waits until no change is received for the quiet period before loading the field
+// and running the callback. All changes of a burst are coalesced in a single load and a single
+// callback, where the event describes the last change and Event.Paths lists all changed paths. A
+// burst that never stops delays the callback until it stops
+func WithDebounce(quiet time.Duration) WatchOption {
+	return func(options *watchOptions) {
+		options.debounce = quiet
+	}
+}
+
+// Approval decides if a new value received by a watch can be copied to the configuration. It
+// receives the path of the field and a pointer to a copy of the field with the new value (the
+// same type of the configuration field). When an error is returned, the field keeps the previous
+// value and a RejectedError is reported
+type Approval func(path string, proposed interface{}) error
+
+// WithApproval defines a function that must approve the new values received by the watch before
+// they are copied to the configuration, for example to validate them. Removed keys are approved in
+// the same way, with the value that would replace the removed one. The function runs in the go
+// routine of the watch
+func WithApproval(approve Approval) WatchOption {
+	return func(options *watchOptions) {
+		options.approve = approve
+	}
+}
+
+func newWatchOptions(opts []WatchOption) watchOptions {
+	options := watchOptions{
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		buffer:     1,
+		overflow:   OverflowCoalesce,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.maxBackoff < options.minBackoff {
+		options.maxBackoff = options.minBackoff
+	}
+
+	return options
+}
+
+func (o watchOptions) report(err error) {
+	if o.errorHandler != nil {
+		o.errorHandler(err)
+	}
+}
+
+// Watch keeps track of a specific field in etcd using a long polling strategy.
+// When a change is detected the callback function will run. When you want to stop watching the
+// field, just close the returning channel (or send any value to it)
+func (c *Client) Watch(field interface{}, callback func()) (chan<- bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := c.WatchContext(ctx, field, callback); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	stop := make(chan bool)
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	return stop, nil
+}
+
+// WatchContext works in the same way of Watch, but the watch stops when the context is done. The
+// returned channel is closed after the watch is completely stopped, so you can wait for it when
+// you need to be sure that the callback will not run anymore. The watch starts after the etcd
+// index where the field was loaded, so changes made after the load aren't lost. When the watch fails it's
+// resumed automatically after the last received change. If etcd doesn't have the changes anymore,
+// the field is loaded again (running the callback when something changed)
+func (c *Client) WatchContext(
+	ctx context.Context,
+	field interface{},
+	callback func(),
+	opts ...WatchOption,
+) (<-chan struct{}, error) {
+
+	return c.WatchEvents(ctx, field, func(Event) {
+		callback()
+	}, opts...)
+}
+
+// WatchEvents works in the same way of WatchContext, but the callback receives the details of the
+// change that was detected
+func (c *Client) WatchEvents(
+	ctx context.Context,
+	field interface{},
+	callback func(Event),
+	opts ...WatchOption,
+) (<-chan struct{}, error) {
+
+	path, _, err := c.getInfo(field)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+	}
+
+	done := make(chan struct{})
+	go c.watch(ctx, fieldValue, path, callback, newWatchOptions(opts), done)
+	return done, nil
+}
+
+// WatchAll watches all the fields of the configuration with a single etcd watch on the namespace.
+// For each change only the field of the changed path is loaded again, and the callback receives
+// an event with the changed path and a pointer to the changed field (Event.Field). Changes of keys
+// that don't belong to any field are ignored. The watch stops when the context is done, and is
+// re-established in the same way of WatchContext
+func (c *Client) WatchAll(
+	ctx context.Context,
+	callback func(Event),
+	opts ...WatchOption,
+) (<-chan struct{}, error) {
+
+	if c.config.Kind() != reflect.Ptr {
+		return nil, ErrInvalidConfig
+	}
+
+	namespace := c.namespace
+	if len(namespace) > 0 {
+		namespace = "/" + namespace
+	}
+
+	done := make(chan struct{})
+	go c.watch(ctx, c.config.Elem(), namespace, callback, newWatchOptions(opts), done)
+	return done, nil
+}
+
+// watch keeps the watch of the path running until the context is done. The watch starts after the
+// etcd index where the path was loaded, and when it fails it's resumed after the last received
+// change, waiting an exponential backoff between the attempts. The done channel is closed after the
+// go-etcd watch returns
+func (c *Client) watch(
+	ctx context.Context,
+	field reflect.Value,
+	path string,
+	callback func(Event),
+	options watchOptions,
+	done chan<- struct{},
+) {
+
+	defer close(done)
+	backoff := options.minBackoff
+
+	// Changes made after the field was loaded must be received
+	index := c.startIndex(path)
+
+	for {
+		next, err := c.watchOnce(ctx, field, path, index, callback, options)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if next != index {
+			backoff = options.minBackoff
+		}
+		index = next
+
+		if indexClearedError(err) {
+			// etcd only keeps the recent changes, so this is expected after a long time without changes.
+			// We load the field again right away and watch from the current index
+			if index, err = c.reload(field, path, callback, options.approve); err != nil {
+				options.report(err)
+			}
+
+			if index > 0 {
+				continue
+			}
+
+		} else {
+			options.report(&FieldError{Path: path, Type: field.Type(), Err: err})
+		}
+
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+
+			if backoff *= 2; backoff > options.maxBackoff {
+				backoff = options.maxBackoff
+			}
+
+			// When etcd doesn't have the changes after the index anymore (or we don't know the index)
+			// we need to load the field again, and watch from the current index
+			if index > 0 && !indexClearedError(err) {
+				break
+			}
+
+			if index, err = c.reload(field, path, callback, options.approve); err != nil {
+				options.report(err)
+			}
+
+			// A value that cannot be loaded is only fixed by a new change, so we keep watching
+			if index > 0 {
+				break
+			}
+		}
+	}
+}
+
+// reload loads the field again to recover the changes that were lost while the watch was down.
+// The callback runs when something changed. The index to resume the watch is returned, even when
+// the field has invalid values; it is zero only when etcd couldn't be queried
+func (c *Client) reload(
+	field reflect.Value,
+	path string,
+	callback func(Event),
+	approve Approval,
+) (uint64, error) {
+
+	versions := c.versions(path)
+	previous := c.collection(field, true)
+
+	index, err := c.refresh([]reflect.Value{field}, []string{path}, approve)
+	if err != nil {
+		if index > 0 {
+			index++
+		}
+		return index, err
+	}
+
+	reloaded := c.versions(path)
+
+	var paths []string
+	for p, version := range reloaded {
+		if previous, ok := versions[p]; !ok || previous != version {
+			paths = append(paths, p)
+		}
+	}
+
+	for p := range versions {
+		if _, ok := reloaded[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+
+	if len(paths) > 0 {
+		sort.Strings(paths)
+		event := Event{
+			Path:    path,
+			Action:  EventReload,
+			Version: reloaded[path],
+			Field:   field.Addr().Interface(),
+			Paths:   paths,
+		}
+
+		if previous.IsValid() {
+			c.configLock.RLock()
+			event.Added, event.Removed, event.Modified = entriesChanges(previous, c.collection(field, false))
+			c.configLock.RUnlock()
+		}
+
+		callback(event)
+	}
+
+	return index + 1, nil
+}
+
+// versions returns the loaded versions of the path and of all paths under it
+func (c *Client) versions(path string) map[string]uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	versions := make(map[string]uint64)
+	for p, i := range c.info {
+		if i.synced && (p == path || strings.HasPrefix(p, path+"/")) {
+			versions[p] = i.version
+		}
+	}
+
+	return versions
+}
+
+// startIndex returns the index where the watch of the path starts. Each field can be loaded by a
+// different request, in a different etcd index, so the watch starts after the oldest response that
+// loaded the path, its parents or its children; otherwise a change of a field that was loaded
+// before the others could be skipped. When the index of the loads isn't known the watch starts
+// after the last version of the path
+func (c *Client) startIndex(path string) uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var loaded, version uint64
+	for p, i := range c.info {
+		child := p == path || strings.HasPrefix(p, path+"/")
+		if !child && !strings.HasPrefix(path, p+"/") {
+			continue
+		}
+
+		if i.loaded > 0 && (loaded == 0 || i.loaded < loaded) {
+			loaded = i.loaded
+		}
+
+		if child && i.synced && i.version > version {
+			version = i.version
+		}
+	}
+
+	if loaded > 0 {
+		return loaded + 1
+	} else if version > 0 {
+		return version + 1
+	}
+
+	return 0
+}
+
+// watchOnce receives the changes of the path after the index until the context is done or the
+// go-etcd watch returns. It returns the index after the last received change and the error that
+// stopped the watch
+func (c *Client) watchOnce(
+	ctx context.Context,
+	field reflect.Value,
+	path string,
+	index uint64,
+	callback func(Event),
+	options watchOptions,
+) (next uint64, err error) {
+
+	next = index
+	stop := make(chan bool)
+	receiver := make(chan *etcd.Response)
+	finished := make(chan struct{})
+
+	// changes waiting for the quiet period when debouncing
+	var pending []*etcd.Response
+	var quiet <-chan time.Time
+
+	go func() {
+		defer close(finished)
+
+		root := path
+		if len(root) == 0 {
+			root = "/"
+		}
+
+		if _, err = c.etcdClient.Watch(root, index, true, receiver, stop); err == nil {
+			err = errWatchClosed
+		}
+	}()
+
+	for {
+		select {
+		case response, ok := <-receiver:
+			if !ok {
+				// go-etcd closes the receiver when the watch returns
+				receiver = nil
+
+			} else if response != nil {
+				if response.Node != nil && response.Node.ModifiedIndex >= next {
+					next = response.Node.ModifiedIndex + 1
+				}
+
+				pending = append(pending, response)
+				if options.debounce > 0 {
+					quiet = time.After(options.debounce)
+					continue
+				}
+
+				c.apply(field, path, pending, callback, options)
+				pending, quiet = nil, nil
+			}
+
+		case <-quiet:
+			c.apply(field, path, pending, callback, options)
+			pending, quiet = nil, nil
+
+		case <-finished:
+			// changes received before the watch failed are not lost
+			if len(pending) > 0 {
+				c.apply(field, path, pending, callback, options)
+			}
+			return
+
+		case <-ctx.Done():
+			close(stop)
+
+			// go-etcd only checks the stop channel while waiting for etcd, so we need to drain the
+			// receiver until it returns
+			for {
+				select {
+				case _, ok := <-receiver:
+					if !ok {
+						receiver = nil
+					}
+
+				case <-finished:
+					return
+				}
+			}
+		}
+	}
+}
+
+// apply loads again the fields of the received changes and runs the callback once for all of them.
+// When the changes are from different fields, the event refers to the watched field
+func (c *Client) apply(
+	field reflect.Value,
+	path string,
+	responses []*etcd.Response,
+	callback func(Event),
+	options watchOptions,
+) {
+
+	var targets []reflect.Value
+	var targetPaths, paths []string
+	var last *etcd.Response
+
+	for _, response := range responses {
+		target, targetPath := field, path
+		if response.Node != nil {
+			target, targetPath = locate(field, path, response.Node.Key)
+
+			// Keys that don't belong to any field (unknown keys) don't change the configuration
+			if _, ok := holderOf(target); !ok && target.Kind() == reflect.Struct &&
+				response.Node.Key != targetPath {
+
+				continue
+			}
+
+			paths = append(paths, response.Node.Key)
+		}
+
+		last = response
+
+		// A field is loaded only once, together with its subfields
+		found := false
+		for i := 0; i < len(targetPaths); i++ {
+			if p := targetPaths[i]; p == targetPath || strings.HasPrefix(targetPath, p+"/") {
+				found = true
+				break
+
+			} else if strings.HasPrefix(p, targetPath+"/") {
+				targets = append(targets[:i], targets[i+1:]...)
+				targetPaths = append(targetPaths[:i], targetPaths[i+1:]...)
+				i--
+			}
+		}
+
+		if !found {
+			targets = append(targets, target)
+			targetPaths = append(targetPaths, targetPath)
+		}
+	}
+
+	if last == nil {
+		return
+	}
+
+	// The previous value of a collection is needed to know which entries changed
+	var previous reflect.Value
+	if len(targets) == 1 {
+		previous = c.collection(targets[0], true)
+	}
+
+	// When watching a directory (slice, map or structure) the response will be from the node that
+	// changed and not the entire directory. So we need to query the directory of the changed fields
+	// again with recursion to load them correctly.
+	if _, err := c.refresh(targets, targetPaths, options.approve); err != nil {
+		options.report(err)
+		return
+	}
+
+	event := newEvent(last, field, path)
+	if len(responses) > 1 {
+		event.Paths = uniquePaths(paths)
+
+		if len(targets) > 1 {
+			event.Field = field.Addr().Interface()
+		}
+	}
+
+	if previous.IsValid() {
+		c.configLock.RLock()
+		event.Added, event.Removed, event.Modified = entriesChanges(previous, c.collection(targets[0], false))
+		c.configLock.RUnlock()
+	}
+
+	callback(event)
+}
+
+// collection returns the map or slice stored in the field, directly or in a Value field. When
+// copied, the returned collection doesn't share memory with the configuration; otherwise the caller
+// must hold the configuration lock. An invalid value is returned for other types
+func (c *Client) collection(field reflect.Value, copied bool) reflect.Value {
+	if holder, ok := holderOf(field); ok {
+		field = holder.reflectValue()
+	}
+
+	if field.Kind() != reflect.Map && field.Kind() != reflect.Slice {
+		return reflect.Value{}
+	}
+
+	if !copied {
+		return field
+	}
+
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	value := reflect.New(field.Type()).Elem()
+	deepCopy(value, field)
+	return value
+}
+
+// entriesChanges compares the entries of two maps or slices, returning the keys (or indexes) that
+// were added, removed or modified
+func entriesChanges(previous, current reflect.Value) (added, removed, modified []string) {
+	if current.Kind() == reflect.Slice {
+		for i := 0; i < previous.Len() || i < current.Len(); i++ {
+			switch {
+			case i >= previous.Len():
+				added = append(added, strconv.Itoa(i))
+			case i >= current.Len():
+				removed = append(removed, strconv.Itoa(i))
+			case !reflect.DeepEqual(previous.Index(i).Interface(), current.Index(i).Interface()):
+				modified = append(modified, strconv.Itoa(i))
+			}
+		}
+
+		return
+	}
+
+	for _, key := range current.MapKeys() {
+		if value := previous.MapIndex(key); !value.IsValid() {
+			added = append(added, fmt.Sprint(key.Interface()))
+		} else if !reflect.DeepEqual(value.Interface(), current.MapIndex(key).Interface()) {
+			modified = append(modified, fmt.Sprint(key.Interface()))
+		}
+	}
+
+	for _, key := range previous.MapKeys() {
+		if !current.MapIndex(key).IsValid() {
+			removed = append(removed, fmt.Sprint(key.Interface()))
+		}
+	}
+
+	sortEntries(added)
+	sortEntries(removed)
+	sortEntries(modified)
+	return
+}
+
+// sortEntries sorts map keys or slice indexes. Numeric keys are sorted by their value, so that
+// slice indexes are in ascending order
+func sortEntries(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+
+		return keys[i] < keys[j]
+	})
+}
+
+// refresh loads the fields again after a change. The fields are only changed when all of them were
+// loaded and approved, so the configuration is never partially updated. The highest etcd index of
+// the responses is returned
+func (c *Client) refresh(fields []reflect.Value, paths []string, approve Approval) (uint64, error) {
+	var errs Errors
+	var index uint64
+
+	shadows := make([]reflect.Value, len(fields))
+	staged := make(map[string]info)
+
+	for i, field := range fields {
+		shadow, fieldIndex, err := c.prepare(field, paths[i], approve, staged)
+		if err != nil {
+			errs = errs.add(err)
+		}
+
+		shadows[i] = shadow
+		if fieldIndex > index {
+			index = fieldIndex
+		}
+	}
+
+	if len(errs) == 1 {
+		return index, errs[0]
+	} else if len(errs) > 1 {
+		return index, errs
+	}
+
+	changed := c.commit(fields, shadows, paths, staged)
+	c.publish(index)
+	notify(changed)
+	return index, nil
+}
+
+// prepare fetches the field after a change and checks if the new value is approved. When the key of
+// the field doesn't exist anymore (it was deleted or expired) the field is reset, so that the
+// configuration doesn't keep a value that was removed from etcd
+func (c *Client) prepare(
+	field reflect.Value,
+	path string,
+	approve Approval,
+	staged map[string]info,
+) (reflect.Value, uint64, error) {
+
+	shadow, index, err := c.fetch(field, path, staged)
+
+	if fieldErr, ok := err.(*FieldError); ok && notFoundError(fieldErr.Err) {
+		index = fieldErr.Err.(*etcd.EtcdError).Index
+		loadedAt(staged, path, index)
+
+		shadow, err = c.reset(field, path)
+	}
+
+	if err == nil {
+		err = check(approve, field, path, shadow)
+	}
+
+	return shadow, index, err
+}
+
+// reset returns the value of a removed field, that is the zero value or the value of the 'default'
+// tag of the field (and of its subfields). Maps and slices are always emptied, and maps are kept
+// allocated so they can still be written
+func (c *Client) reset(field reflect.Value, path string) (reflect.Value, error) {
+	value := reflect.New(field.Type()).Elem()
+	if err := c.fillDefault(value, path, c.defaultOf(path)); err != nil {
+		return reflect.Value{}, err
+	}
+
+	return value, nil
+}
+
+// check asks the approval function if the proposed value can replace the value of the field
+func check(approve Approval, field reflect.Value, path string, proposed reflect.Value) error {
+	if approve == nil {
+		return nil
+	}
+
+	if err := approve(path, proposed.Addr().Interface()); err != nil {
+		return &FieldError{Path: path, Type: field.Type(), Err: &RejectedError{Err: err}}
+	}
+
+	return nil
+}
+
+// fillDefault fills the field with the value of the 'default' tag. Value fields are always stored,
+// even without a default, to replace the removed value
+func (c *Client) fillDefault(field reflect.Value, path, defaultValue string) error {
+	if holder, ok := holderOf(field); ok {
+		value := reflect.New(holder.elemType()).Elem()
+		if err := c.fillDefault(value, path, defaultValue); err != nil {
+			return err
+		}
+
+		holder.store(value)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Struct:
+		var errs Errors
+
+		for i := 0; i < field.NumField(); i++ {
+			subfieldType := field.Type().Field(i)
+
+			subpath := normalizeTag(subfieldType.Tag.Get("etcd"))
+			if len(subpath) == 0 {
+				continue
+			}
+
+			err := c.fillDefault(field.Field(i), path+"/"+subpath, subfieldType.Tag.Get("default"))
+			if err != nil {
+				errs = errs.add(err)
+			}
+		}
+
+		return errs.err()
+
+	case reflect.Map:
+		field.Set(reflect.MakeMap(field.Type()))
+
+	case reflect.String, reflect.Int, reflect.Int64, reflect.Bool:
+		if len(defaultValue) > 0 {
+			return c.fillValue(field, &etcd.Node{Key: path, Value: defaultValue})
+		}
+	}
+
+	return nil
+}
+
+// hasDefault checks if the field or any of its subfields has a 'default' tag
+func hasDefault(t reflect.Type, defaultValue string) bool {
+	if len(defaultValue) > 0 {
+		return true
+	}
+
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		subfieldType := t.Field(i)
+		if len(normalizeTag(subfieldType.Tag.Get("etcd"))) == 0 {
+			continue
+		}
+
+		if hasDefault(subfieldType.Type, subfieldType.Tag.Get("default")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultOf returns the 'default' tag of the configuration field of the path
+func (c *Client) defaultOf(path string) string {
+	current := c.namespace
+	if len(current) > 0 {
+		current = "/" + current
+	}
+
+	t := c.config.Elem().Type()
+	for t.Kind() == reflect.Struct {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag := normalizeTag(t.Field(i).Tag.Get("etcd"))
+			if len(tag) == 0 {
+				continue
+			}
+
+			subpath := current + "/" + tag
+			if path == subpath {
+				return t.Field(i).Tag.Get("default")
+			}
+
+			if strings.HasPrefix(path, subpath+"/") {
+				t, current, found = t.Field(i).Type, subpath, true
+				break
+			}
+		}
+
+		if !found {
+			break
+		}
+	}
+
+	return ""
+}
+
+// uniquePaths sorts the paths and removes the repeated ones
+func uniquePaths(paths []string) []string {
+	sort.Strings(paths)
+
+	var unique []string
+	for i, path := range paths {
+		if i == 0 || path != paths[i-1] {
+			unique = append(unique, path)
+		}
+	}
+
+	return unique
+}
+
+// fillField copies the etcd node values into the field. The state of each filled path is stored in
+// the known map, that is usually the client information. Values that cannot be converted don't stop
+// the process, and all of them are reported at the end
+func (c *Client) fillField(field reflect.Value, node *etcd.Node, prefix string, known map[string]info) error {
+	if holder, ok := holderOf(field); ok {
+		value := reflect.New(holder.elemType()).Elem()
+		if err := c.fillField(value, node, prefix, known); err != nil {
+			return err
+		}
+
+		holder.store(value)
+		record(known, node.Key, field, node.Value, node.ModifiedIndex)
+		return nil
+	}
+
+	var errs Errors
+
+	switch field.Kind() {
+	case reflect.Struct:
+		for i := 0; i < field.NumField(); i++ {
+			subfield := field.Field(i)
+			subfieldType := field.Type().Field(i)
+
+			path := normalizeTag(subfieldType.Tag.Get("etcd"))
+			if len(path) == 0 {
+				continue
+			}
+			path = prefix + "/" + path
+
+			found := false
+			for _, child := range node.Nodes {
+				if path == child.Key {
+					if err := c.fillField(subfield, child, path, known); err != nil {
+						errs = errs.add(err)
+					}
+
+					found = true
+					break
+				}
+			}
+
+			defaultValue := subfieldType.Tag.Get("default")
+			if !found && hasDefault(subfield.Type(), defaultValue) {
+				subfield.Set(reflect.Zero(subfield.Type()))
+				if err := c.fillDefault(subfield, path, defaultValue); err != nil {
+					errs = errs.add(err)
+				}
+			}
+		}
+
+	case reflect.Map:
+		field.Set(reflect.MakeMap(field.Type()))
+
+		// Keys that were removed from etcd shouldn't be considered anymore when saving
+		forget(known, prefix)
+
+		switch field.Type().Elem().Kind() {
+		case reflect.Struct:
 			for _, node := range node.Nodes {
 				newStruct := reflect.New(field.Type().Elem()).Elem()
-				if err := c.fillField(newStruct, node, node.Key); err != nil {
-					return err
+				if err := c.fillField(newStruct, node, node.Key, known); err != nil {
+					errs = errs.add(err)
+					continue
 				}
 
 				pathParts := strings.Split(node.Key, "/")
@@ -435,15 +2801,22 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, prefix string)
 					reflect.ValueOf(pathParts[len(pathParts)-1]),
 					reflect.ValueOf(node.Value),
 				)
+
+				record(known, node.Key, reflect.Value{}, node.Value, node.ModifiedIndex)
 			}
 		}
 
 	case reflect.Slice:
 		field.Set(reflect.MakeSlice(field.Type(), 0, len(node.Nodes)))
+		forget(known, prefix)
 
-		switch field.Type().Elem().Kind() {
-		case reflect.Struct:
-			for i, item := range node.Nodes {
+		if field.Type().Elem().Kind() == reflect.Struct {
+			// etcd sorts the keys as strings, so "10" would come before "2"
+			items := make(etcd.Nodes, len(node.Nodes))
+			copy(items, node.Nodes)
+			sort.Sort(byIndex(items))
+
+			for _, item := range items {
 				newStruct := reflect.New(field.Type().Elem()).Elem()
 
 			SubitemLoop:
@@ -456,79 +2829,102 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, prefix string)
 						if len(path) == 0 {
 							continue
 						}
-						path = fmt.Sprintf("%s/%d/%s", prefix, i, path)
+						path = item.Key + "/" + path
 
 						if path == subitem.Key {
-							if err := c.fillField(subfield, subitem, path); err != nil {
-								return err
+							if err := c.fillField(subfield, subitem, path, known); err != nil {
+								errs = errs.add(err)
 							}
 							continue SubitemLoop
 						}
 					}
 				}
 				field.Set(reflect.Append(field, newStruct))
+				record(known, item.Key, reflect.Value{}, item.Value, item.ModifiedIndex)
 			}
 
-		case reflect.String:
-			for _, node := range node.Nodes {
-				field.Set(reflect.Append(field, reflect.ValueOf(node.Value)))
-			}
-
-		case reflect.Int:
+		} else if _, ok := formatValue(reflect.Zero(field.Type().Elem())); ok {
 			for _, node := range node.Nodes {
-				value, err := strconv.ParseInt(node.Value, 10, 64)
-				if err != nil {
-					return err
+				item := reflect.New(field.Type().Elem()).Elem()
+				if err := c.fillValue(item, node); err != nil {
+					errs = errs.add(err)
+					continue
 				}
 
-				field.Set(reflect.Append(field, reflect.ValueOf(int(value))))
+				field.Set(reflect.Append(field, item))
+				record(known, node.Key, reflect.Value{}, node.Value, node.ModifiedIndex)
 			}
+		}
 
-		case reflect.Int64:
-			for _, node := range node.Nodes {
-				value, err := strconv.ParseInt(node.Value, 10, 64)
-				if err != nil {
-					return err
-				}
+	default:
+		if err := c.fillValue(field, node); err != nil {
+			return err
+		}
+	}
 
-				field.Set(reflect.Append(field, reflect.ValueOf(value)))
-			}
+	record(known, node.Key, field, node.Value, node.ModifiedIndex)
+	return errs.err()
+}
 
-		case reflect.Bool:
-			for _, node := range node.Nodes {
-				if node.Value == "true" {
-					field.Set(reflect.Append(field, reflect.ValueOf(true)))
-				} else if node.Value == "false" {
-					field.Set(reflect.Append(field, reflect.ValueOf(false)))
-				}
-			}
-		}
+// fillValue converts the etcd node value into a field of a primitive type. Unsupported types are
+// ignored
+func (c *Client) fillValue(field reflect.Value, node *etcd.Node) error {
+	c.lock.RLock()
+	aliases := c.boolAliases
+	c.lock.RUnlock()
+
+	value, err := parseValue(field.Type(), node.Value, aliases)
+	if err != nil {
+		return &FieldError{Path: node.Key, Value: node.Value, Type: field.Type(), Err: err}
+	}
+
+	if value.IsValid() {
+		field.Set(value)
+	}
+	return nil
+}
 
+// parseValue converts the etcd value to a primitive type. Boolean values can also be one of the
+// given aliases. An invalid value is returned for unsupported types
+func parseValue(t reflect.Type, raw string, aliases map[string]bool) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+
+	switch t.Kind() {
 	case reflect.String:
-		field.SetString(node.Value)
+		value.SetString(raw)
 
 	case reflect.Int, reflect.Int64:
-		value, err := strconv.ParseInt(node.Value, 10, 64)
+		parsed, err := strconv.ParseInt(raw, 10, t.Bits())
+		if err != nil && t == durationType {
+			// Durations can also be written manually in a readable format, like "1m30s"
+			var duration time.Duration
+			if duration, err = time.ParseDuration(raw); err == nil {
+				parsed = int64(duration)
+			}
+		}
+
 		if err != nil {
-			return err
+			return reflect.Value{}, err
 		}
 
-		field.SetInt(value)
+		value.SetInt(parsed)
 
 	case reflect.Bool:
-		if node.Value == "true" {
-			field.SetBool(true)
-		} else if node.Value == "false" {
-			field.SetBool(false)
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			var ok bool
+			if parsed, ok = aliases[strings.ToLower(raw)]; !ok {
+				return reflect.Value{}, err
+			}
 		}
-	}
 
-	c.info[node.Key] = info{
-		field:   field,
-		version: node.ModifiedIndex,
+		value.SetBool(parsed)
+
+	default:
+		return reflect.Value{}, nil
 	}
 
-	return nil
+	return value, nil
 }
 
 // Version returns the current version of a field retrieved from etcd.
@@ -552,8 +2948,16 @@ func (c *Client) getInfo(field interface{}) (path string, info info, err error)
 		return
 	}
 
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	found := false
 	for path, info = range c.info {
+		// Map entries and slice items are not addressable, so they can't be retrieved by pointer
+		if !info.field.IsValid() || !info.field.CanAddr() {
+			continue
+		}
+
 		// Match the pointer, type and name to avoid problems for struct and first field that have the
 		// same memory address
 		if info.field.Addr().Pointer() == fieldValue.Addr().Pointer() &&
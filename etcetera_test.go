@@ -5,17 +5,21 @@
 package etcetera
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -55,7 +59,7 @@ func ExampleSave() {
 		return
 	}
 
-	if err := client.Save(); err != nil {
+	if _, err := client.Save(); err != nil {
 		fmt.Println(err.Error())
 		return
 	}
@@ -88,7 +92,7 @@ func ExampleSaveField() {
 		return
 	}
 
-	if err := client.SaveField(&a.Field1); err != nil {
+	if _, err := client.SaveField(&a.Field1); err != nil {
 		fmt.Println(err.Error())
 		return
 	}
@@ -211,7 +215,7 @@ func TestNewClient(t *testing.T) {
 		namespace   string      // namespace used for this configuration
 		config      interface{} // configuration instance (structure) to save
 		expectedErr bool        // error expectation when building the object
-		expected    Client      // expected client object after calling the constructor
+		expected    *Client     // expected client object after calling the constructor
 	}{
 		{
 			description: "it should create a valid Client object",
@@ -222,7 +226,7 @@ func TestNewClient(t *testing.T) {
 			},
 			namespace: "test",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: etcd.NewClient([]string{
 					"http://127.0.0.1:4001",
 					"http://127.0.0.1:4002",
@@ -260,7 +264,7 @@ func TestNewClient(t *testing.T) {
 			},
 			namespace: "/test",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: etcd.NewClient([]string{
 					"http://127.0.0.1:4001",
 					"http://127.0.0.1:4002",
@@ -283,7 +287,7 @@ func TestNewClient(t *testing.T) {
 			},
 			namespace: "test/",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: etcd.NewClient([]string{
 					"http://127.0.0.1:4001",
 					"http://127.0.0.1:4002",
@@ -306,7 +310,7 @@ func TestNewClient(t *testing.T) {
 			},
 			namespace: "test/goes/crazy",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: etcd.NewClient([]string{
 					"http://127.0.0.1:4001",
 					"http://127.0.0.1:4002",
@@ -333,7 +337,7 @@ func TestNewClient(t *testing.T) {
 			continue
 		}
 
-		if !item.expectedErr && !equalClients(c, &item.expected) {
+		if !item.expectedErr && !equalClients(c, item.expected) {
 			t.Errorf("Item %d, “%s”: objects mismatch. Expecting “%+v”; found “%+v”",
 				i, item.description, item.expected, c)
 		}
@@ -360,7 +364,7 @@ func TestNewTLSClient(t *testing.T) {
 		namespace   string      // namespace used for this configuration
 		config      interface{} // configuration instance (structure) to save
 		expectedErr bool        // error expectation when building the object
-		expected    Client      // expected client object after calling the constructor
+		expected    *Client     // expected client object after calling the constructor
 	}{
 		{
 			description: "it should create a valid Client object",
@@ -374,7 +378,7 @@ func TestNewTLSClient(t *testing.T) {
 			caCert:    cert,
 			namespace: "test",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: func() *etcd.Client {
 					client, err := etcd.NewTLSClient([]string{
 						"http://127.0.0.1:4001",
@@ -423,7 +427,7 @@ func TestNewTLSClient(t *testing.T) {
 			caCert:    cert,
 			namespace: "/test",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: func() *etcd.Client {
 					client, err := etcd.NewTLSClient([]string{
 						"http://127.0.0.1:4001",
@@ -457,7 +461,7 @@ func TestNewTLSClient(t *testing.T) {
 			caCert:    cert,
 			namespace: "test/",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: func() *etcd.Client {
 					client, err := etcd.NewTLSClient([]string{
 						"http://127.0.0.1:4001",
@@ -491,7 +495,7 @@ func TestNewTLSClient(t *testing.T) {
 			caCert:    cert,
 			namespace: "test/goes/crazy",
 			config:    &test,
-			expected: Client{
+			expected: &Client{
 				etcdClient: func() *etcd.Client {
 					client, err := etcd.NewTLSClient([]string{
 						"http://127.0.0.1:4001",
@@ -579,7 +583,7 @@ func TestNewTLSClient(t *testing.T) {
 			continue
 		}
 
-		if !item.expectedErr && !equalClients(c, &item.expected) {
+		if !item.expectedErr && !equalClients(c, item.expected) {
 			t.Errorf("Item %d, “%s”: objects mismatch. Expecting “%+v”; found “%+v”",
 				i, item.description, item.expected, c)
 		}
@@ -1300,7 +1304,7 @@ func TestSave(t *testing.T) {
 			item.init(mock)
 		}
 
-		err := c.Save()
+		_, err := c.Save()
 		if err == nil && item.expectedErr {
 			t.Errorf("Item %d, “%s”: error expected", i, item.description)
 			continue
@@ -1330,12 +1334,275 @@ func BenchmarkSave(b *testing.B) {
 	}
 
 	for i := 0; i < b.N; i++ {
-		if err := c.Save(); err != nil {
+		if _, err := c.Save(); err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
+func TestSaveOnlyChanges(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+		Field5 []struct {
+			Subfield1 string `etcd:"subfield1"`
+		} `etcd:"field5"`
+		Field6 bool          `etcd:"field6"`
+		Field7 int           `etcd:"field7"`
+		Field8 time.Duration `etcd:"field8"`
+		Field9 []int         `etcd:"field9"`
+	}
+
+	etcdData := func() *etcd.Node {
+		return &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field1", Value: "value1"},
+				{Key: "/field2", Value: "10"},
+				{
+					Key: "/field3",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field3/key1", Value: "value1"},
+					},
+				},
+				{
+					Key: "/field4",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field4/0", Value: "value1"},
+						{Key: "/field4/1", Value: "value2"},
+					},
+				},
+				{
+					Key: "/field5",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{
+							Key: "/field5/0",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/field5/0/subfield1", Value: "subvalue1"},
+							},
+						},
+						{
+							Key: "/field5/1",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/field5/1/subfield1", Value: "subvalue2"},
+							},
+						},
+					},
+				},
+				// values written manually in other formats
+				{Key: "/field6", Value: "yes"},
+				{Key: "/field7", Value: "007"},
+				{Key: "/field8", Value: "1m30s"},
+				{
+					Key: "/field9",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field9/0", Value: "01"},
+					},
+				},
+			},
+		}
+	}
+
+	data := []struct {
+		description string        // describe the test case
+		change      func(*config) // change made in the configuration after loading it
+		expected    []string      // paths written when saving the configuration
+	}{
+		{
+			description: "it should not write anything when nothing changed",
+			change:      func(c *config) {},
+		},
+		{
+			description: "it should write only the changed fields",
+			change: func(c *config) {
+				c.Field1 = "value1 modified"
+			},
+			expected: []string{"/field1"},
+		},
+		{
+			description: "it should add and remove map keys",
+			change: func(c *config) {
+				delete(c.Field3, "key1")
+				c.Field3["key2"] = "value2"
+			},
+			expected: []string{"/field3/key2", "/field3/key1"},
+		},
+		{
+			description: "it should replace and append slice items",
+			change: func(c *config) {
+				c.Field4 = []string{"value1", "value2 modified", "value3"}
+			},
+			expected: []string{"/field4/1", "/field4/2"},
+		},
+		{
+			description: "it should remove slice items",
+			change: func(c *config) {
+				c.Field4 = c.Field4[:1]
+			},
+			expected: []string{"/field4/1"},
+		},
+		{
+			description: "it should remove structures from a slice",
+			change: func(c *config) {
+				c.Field5 = c.Field5[:1]
+			},
+			expected: []string{"/field5/1"},
+		},
+		{
+			description: "it should write values written in other formats only when they change",
+			change: func(c *config) {
+				c.Field6 = false
+				c.Field8 = time.Minute
+			},
+			expected: []string{"/field6", "/field8"},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSaveOnlyChanges for index %d\n", i)
+		}
+
+		var cfg config
+
+		mock := NewClientMock()
+		mock.root = etcdData()
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+		c.SetBoolAliases(map[string]bool{"yes": true})
+
+		if err := c.Load(); err != nil {
+			// We are not testing load errors here, so make it fatal
+			t.Fatalf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+		}
+
+		item.change(&cfg)
+
+		written, err := c.Save()
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(written, item.expected) {
+			t.Errorf("Item %d, “%s”: written paths mismatch. Expecting “%v”; found “%v”",
+				i, item.description, item.expected, written)
+		}
+
+		// Saving again must not write anything, as etcd is already synchronized
+		if written, err := c.Save(); err != nil || len(written) > 0 {
+			t.Errorf("Item %d, “%s”: unexpected writes after synchronizing. Found “%v” (%v)",
+				i, item.description, written, err)
+		}
+
+		var reloaded config
+		r := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&reloaded),
+			info:       make(map[string]info),
+		}
+		r.SetBoolAliases(map[string]bool{"yes": true})
+
+		if err := r.Load(); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error reloading. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(cfg, reloaded) {
+			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, cfg, reloaded)
+		}
+	}
+}
+
+func TestSaveRemovedEntries(t *testing.T) {
+	type entry struct {
+		Subfield1 string `etcd:"subfield1"`
+	}
+
+	type config struct {
+		Field1 map[string]entry `etcd:"field1"`
+	}
+
+	data := []struct {
+		description string                                         // describe the test case
+		save        func(c *Client, cfg *config) ([]string, error) // save after removing the entry
+	}{
+		{
+			description: "it should remove a saved structure entry when saving the configuration",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				return c.Save()
+			},
+		},
+		{
+			description: "it should remove a saved structure entry when saving the map entry",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				return c.SaveMapEntry(&cfg.Field1, "key2")
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSaveRemovedEntries for index %d\n", i)
+		}
+
+		cfg := config{
+			Field1: map[string]entry{
+				"key1": {Subfield1: "value1"},
+				"key2": {Subfield1: "value2"},
+			},
+		}
+
+		mock := NewClientMock()
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		if _, err := c.Save(); err != nil {
+			t.Fatalf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+		}
+
+		delete(cfg.Field1, "key2")
+
+		written, err := item.save(&c, &cfg)
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if expected := []string{"/field1/key2"}; !reflect.DeepEqual(written, expected) {
+			t.Errorf("Item %d, “%s”: written paths mismatch. Expecting “%v”; found “%v”",
+				i, item.description, expected, written)
+		}
+
+		if _, err := mock.Get("/field1/key2", false, false); !notFoundError(err) {
+			t.Errorf("Item %d, “%s”: entry not removed from etcd", i, item.description)
+		}
+
+		if _, err := mock.Get("/field1/key1/subfield1", false, false); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error retrieving the remaining entry. %s",
+				i, item.description, err.Error())
+		}
+	}
+}
+
 func TestSaveField(t *testing.T) {
 	config := struct {
 		Field1 string `etcd:"field1"`
@@ -1519,7 +1786,7 @@ func TestSaveField(t *testing.T) {
 
 		c.preload(c.config, "")
 
-		err := c.SaveField(item.field)
+		_, err := c.SaveField(item.field)
 		if err == nil && item.expectedErr {
 			t.Errorf("Item %d, “%s”: error expected", i, item.description)
 			continue
@@ -1554,836 +1821,4304 @@ func BenchmarkSaveField(b *testing.B) {
 	c.preload(c.config, "")
 
 	for i := 0; i < b.N; i++ {
-		if err := c.SaveField(&config.Field); err != nil {
+		if _, err := c.SaveField(&config.Field); err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
-func TestLoad(t *testing.T) {
-	data := []struct {
-		description string            // describe the test case
-		init        func(*clientMock) // initial configuration of the mocked client (if necessary)
-		etcdData    etcd.Node         // etcd state before loading the configuration
-		namespace   string            // namespace of the configuration in the etcd
-		config      interface{}       // configuration structure (used to detect what we need to look for in etcd)
-		expectedErr bool              // error expectation when loading the configuration
-		expected    interface{}       // configuration instance expected after loading
-	}{
-		{
-			description: "it should load an one-level configuration ignoring not tagged or invalid tag fields",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field1",
-						Value: "value1",
+func TestSaveEntry(t *testing.T) {
+	type config struct {
+		Field1 map[string]string `etcd:"field1"`
+		Field2 map[string]struct {
+			Subfield1 string `etcd:"subfield1"`
+		} `etcd:"field2"`
+		Field3 []string `etcd:"field3"`
+		Field4 []struct {
+			Subfield1 string `etcd:"subfield1"`
+		} `etcd:"field4"`
+		Field5 string `etcd:"field5"`
+	}
+
+	etcdData := func() *etcd.Node {
+		return &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{
+					Key: "/field1",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field1/key1", Value: "value1"},
+						{Key: "/field1/key2", Value: "value2"},
 					},
-					{
-						Key:   "/field2",
-						Value: "10",
+				},
+				{
+					Key: "/field2",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{
+							Key: "/field2/key1",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/field2/key1/subfield1", Value: "subvalue1"},
+							},
+						},
 					},
-					{
-						Key:   "/field3",
-						Value: "20",
+				},
+				{
+					Key: "/field3",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field3/0", Value: "value1"},
+						{Key: "/field3/1", Value: "value2"},
 					},
-					{
-						Key:   "/field4",
-						Value: "true",
+				},
+				{
+					Key: "/field4",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{
+							Key: "/field4/0",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/field4/0/subfield1", Value: "subvalue1"},
+							},
+						},
 					},
 				},
+				{Key: "/field5", Value: "value5"},
 			},
-			config: &struct {
-				Field1 string `etcd:"/field1"`
-				Field2 int    `etcd:"field2/"`
-				Field3 int64  `etcd:"/field3/"`
-				Field4 bool   `etcd:"//field4//"`
-				Extra1 string
-				Extra2 string `etcd:"///"`
-			}{},
-			expected: struct {
-				Field1 string `etcd:"/field1"`
-				Field2 int    `etcd:"field2/"`
-				Field3 int64  `etcd:"/field3/"`
-				Field4 bool   `etcd:"//field4//"`
-				Extra1 string
-				Extra2 string `etcd:"///"`
-			}{
-				Field1: "value1",
-				Field2: 10,
-				Field3: 20,
-				Field4: true,
+		}
+	}
+
+	data := []struct {
+		description string                                   // describe the test case
+		save        func(*Client, *config) ([]string, error) // change and save the entry
+		expectedErr bool                                     // error expectation when saving the entry
+		expected    []string                                 // paths written when saving the entry
+	}{
+		{
+			description: "it should save only the changed map entry",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				cfg.Field1["key1"] = "value1 modified"
+				cfg.Field1["key2"] = "value2 modified"
+				return c.SaveMapEntry(&cfg.Field1, "key1")
 			},
+			expected: []string{"/field1/key1"},
 		},
 		{
-			description: "it should load an embedded structure",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/subfield1",
-								Value: "10",
-							},
-							{
-								Key:   "/field/subfield2",
-								Value: "20",
-							},
-							{
-								Key:   "/field/subfield3",
-								Value: "false",
-							},
-						},
-					},
-				},
+			description: "it should add a new map entry",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				cfg.Field1["key3"] = "value3"
+				return c.SaveMapEntry(&cfg.Field1, "key3")
 			},
-			config: &struct {
-				Field1 struct {
-					Subfield1 int   `etcd:"subfield1"`
-					Subfield2 int64 `etcd:"subfield2"`
-					Subfield3 bool  `etcd:"subfield3"`
-				} `etcd:"field"`
-			}{},
-			expected: struct {
-				Field1 struct {
-					Subfield1 int   `etcd:"subfield1"`
-					Subfield2 int64 `etcd:"subfield2"`
-					Subfield3 bool  `etcd:"subfield3"`
-				} `etcd:"field"`
-			}{
-				Field1: struct {
-					Subfield1 int   `etcd:"subfield1"`
-					Subfield2 int64 `etcd:"subfield2"`
-					Subfield3 bool  `etcd:"subfield3"`
-				}{
-					Subfield1: 10,
-					Subfield2: 20,
-					Subfield3: false,
-				},
+			expected: []string{"/field1/key3"},
+		},
+		{
+			description: "it should remove a map entry that doesn't exist anymore",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				delete(cfg.Field1, "key2")
+				return c.SaveMapEntry(&cfg.Field1, "key2")
 			},
+			expected: []string{"/field1/key2"},
 		},
 		{
-			description: "it should load a slice of strings",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/0",
-								Value: "value1",
-							},
-							{
-								Key:   "/field/1",
-								Value: "value2",
-							},
-							{
-								Key:   "/field/2",
-								Value: "value3",
-							},
-						},
-					},
-				},
+			description: "it should save a structure map entry",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				entry := cfg.Field2["key1"]
+				entry.Subfield1 = "subvalue1 modified"
+				cfg.Field2["key1"] = entry
+				return c.SaveMapEntry(&cfg.Field2, "key1")
+			},
+			expected: []string{"/field2/key1/subfield1"},
+		},
+		{
+			description: "it should save only the changed slice element",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				cfg.Field3[0] = "value1 modified"
+				cfg.Field3[1] = "value2 modified"
+				return c.SaveSliceElement(&cfg.Field3, 1)
 			},
-			config: &struct {
-				Field []string `etcd:"field"`
-			}{},
-			expected: struct {
-				Field []string `etcd:"field"`
-			}{
-				Field: []string{"value1", "value2", "value3"},
+			expected: []string{"/field3/1"},
+		},
+		{
+			description: "it should append a new slice element",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				cfg.Field3 = append(cfg.Field3, "value3")
+				return c.SaveSliceElement(&cfg.Field3, 2)
 			},
+			expected: []string{"/field3/2"},
 		},
 		{
-			description: "it should load a slice of int",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/0",
-								Value: "10",
-							},
-							{
-								Key:   "/field/1",
-								Value: "20",
-							},
-							{
-								Key:   "/field/2",
-								Value: "30",
-							},
-						},
-					},
-				},
+			description: "it should save a structure slice element",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				cfg.Field4[0].Subfield1 = "subvalue1 modified"
+				return c.SaveSliceElement(&cfg.Field4, 0)
 			},
-			config: &struct {
-				Field []int `etcd:"field"`
-			}{},
-			expected: struct {
-				Field []int `etcd:"field"`
-			}{
-				Field: []int{10, 20, 30},
+			expected: []string{"/field4/0/subfield1"},
+		},
+		{
+			description: "it should fail to save a slice element out of range",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				return c.SaveSliceElement(&cfg.Field3, 5)
 			},
+			expectedErr: true,
 		},
 		{
-			description: "it should load a slice of int64",
-			etcdData: etcd.Node{
-				Dir: true,
+			description: "it should fail to save an entry of a field that isn't a map",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				return c.SaveMapEntry(&cfg.Field5, "key1")
+			},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail to save an element of a field that isn't a slice",
+			save: func(c *Client, cfg *config) ([]string, error) {
+				return c.SaveSliceElement(&cfg.Field1, 0)
+			},
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSaveEntry for index %d\n", i)
+		}
+
+		var cfg config
+
+		mock := NewClientMock()
+		mock.root = etcdData()
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+		if err := c.Load(); err != nil {
+			// We are not testing load errors here, so make it fatal
+			t.Fatalf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+		}
+
+		written, err := item.save(&c, &cfg)
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !item.expectedErr && !reflect.DeepEqual(written, item.expected) {
+			t.Errorf("Item %d, “%s”: written paths mismatch. Expecting “%v”; found “%v”",
+				i, item.description, item.expected, written)
+		}
+	}
+}
+
+func TestEntryVersion(t *testing.T) {
+	etcdData := etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{
+				Key:           "/field1",
+				Dir:           true,
+				ModifiedIndex: 100,
 				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/0",
-								Value: "10",
-							},
-							{
-								Key:   "/field/1",
-								Value: "20",
-							},
-							{
-								Key:   "/field/2",
-								Value: "30",
-							},
-						},
-					},
+					{Key: "/field1/key1", Value: "value1", ModifiedIndex: 200},
 				},
 			},
-			config: &struct {
-				Field []int64 `etcd:"field"`
-			}{},
-			expected: struct {
-				Field []int64 `etcd:"field"`
-			}{
-				Field: []int64{10, 20, 30},
+			{
+				Key:           "/field2",
+				Dir:           true,
+				ModifiedIndex: 300,
+				Nodes: etcd.Nodes{
+					{Key: "/field2/0", Value: "value1", ModifiedIndex: 400},
+				},
 			},
 		},
+	}
+
+	config := struct {
+		Field1 map[string]string `etcd:"field1"`
+		Field2 []string          `etcd:"field2"`
+	}{}
+
+	mock := NewClientMock()
+	mock.root = &etcdData
+
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&config),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+	if err := c.Load(); err != nil {
+		// We are not testing load errors here, so make it fatal
+		t.Fatalf("Unexpected error. %s", err.Error())
+	}
+
+	data := []struct {
+		description string                 // describe the test case
+		version     func() (uint64, error) // retrieve the version of the entry
+		expectedErr bool                   // error expectation when retrieving the version
+		expected    uint64                 // expected version of the entry
+	}{
 		{
-			description: "it should load a slice of bool",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/0",
-								Value: "true",
-							},
-							{
-								Key:   "/field/1",
-								Value: "false",
-							},
-							{
-								Key:   "/field/2",
-								Value: "true",
-							},
-						},
-					},
-				},
+			description: "it should retrieve the version of a map entry",
+			version: func() (uint64, error) {
+				return c.MapEntryVersion(&config.Field1, "key1")
 			},
-			config: &struct {
-				Field []bool `etcd:"field"`
-			}{},
-			expected: struct {
-				Field []bool `etcd:"field"`
-			}{
-				Field: []bool{true, false, true},
+			expected: 200,
+		},
+		{
+			description: "it should retrieve the version of a slice element",
+			version: func() (uint64, error) {
+				return c.SliceElementVersion(&config.Field2, 0)
 			},
+			expected: 400,
 		},
 		{
-			description: "it should load a slice of structures",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key: "/field/0",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/0/subfield1",
-										Value: "10",
-									},
-									{
-										Key:   "/field/0/subfield2",
-										Value: "20",
-									},
-									{
-										Key:   "/field/0/subfield3",
-										Value: "false",
-									},
-								},
-							},
-							{
-								Key: "/field/1",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/1/subfield1",
-										Value: "20",
-									},
-									{
-										Key:   "/field/1/subfield2",
-										Value: "40",
-									},
-									{
-										Key:   "/field/1/subfield3",
-										Value: "true",
-									},
-								},
-							},
-							{
-								Key: "/field/2",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/2/subfield1",
-										Value: "40",
-									},
-									{
-										Key:   "/field/2/subfield2",
-										Value: "80",
-									},
-									{
-										Key:   "/field/2/subfield3",
-										Value: "false",
-									},
-								},
-							},
-						},
-					},
-				},
+			description: "it should retrieve version 0 for a map entry not retrieved from etcd",
+			version: func() (uint64, error) {
+				return c.MapEntryVersion(&config.Field1, "key2")
 			},
-			config: &struct {
-				Field []struct {
-					Subfield0 string
-					Subfield1 int   `etcd:"subfield1"`
-					Subfield2 int64 `etcd:"subfield2"`
-					Subfield3 bool  `etcd:"subfield3"`
-				} `etcd:"field"`
+		},
+		{
+			description: "it should fail to retrieve the version of a slice element out of range",
+			version: func() (uint64, error) {
+				return c.SliceElementVersion(&config.Field2, 1)
+			},
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestEntryVersion for index %d\n", i)
+		}
+
+		version, err := item.version()
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !item.expectedErr && item.expected != version {
+			t.Errorf("Item %d, “%s”: version mismatch. Expecting “%d”; found “%d”",
+				i, item.description, item.expected, version)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+		Field5 []struct {
+			Subfield1 string `etcd:"subfield1"`
+			Subfield2 int64  `etcd:"subfield2"`
+		} `etcd:"field5"`
+	}
+
+	var original config
+	original.Field1 = "value1"
+	original.Field2 = 10
+	original.Field3 = make(map[string]string)
+	for i := 0; i < 50; i++ {
+		original.Field3[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	for i := 0; i < 9; i++ {
+		original.Field4 = append(original.Field4, fmt.Sprintf("item%d", i))
+		original.Field5 = append(original.Field5, struct {
+			Subfield1 string `etcd:"subfield1"`
+			Subfield2 int64  `etcd:"subfield2"`
+		}{fmt.Sprintf("subvalue%d", i), int64(i)})
+	}
+
+	data := []struct {
+		description string            // describe the test case
+		init        func(*clientMock) // initial configuration of the mocked client (if necessary)
+		expectedErr string            // error expected when saving and loading (if any)
+	}{
+		{
+			description: "it should save and load the same data of the sequential mode",
+		},
+		{
+			description: "it should report the first error in the operations order",
+			init: func(c *clientMock) {
+				c.setErrors["/field3/key7"] = fmt.Errorf("error 1")
+				c.setErrors["/field5/3/subfield1"] = fmt.Errorf("error 2")
+				c.getErrors["/field3"] = fmt.Errorf("error 1")
+				c.getErrors["/field5"] = fmt.Errorf("error 2")
+			},
+			expectedErr: "error 1",
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestConcurrency for index %d\n", i)
+		}
+
+		var results []*clientMock
+		var written [][]string
+		var loaded []config
+
+		for _, concurrency := range []int{0, 8} {
+			cfg := original
+
+			mock := NewClientMock()
+			if item.init != nil {
+				item.init(mock)
+			}
+
+			c := Client{
+				etcdClient: mock,
+				config:     reflect.ValueOf(&cfg),
+				info:       make(map[string]info),
+			}
+			c.SetConcurrency(concurrency)
+
+			paths, err := c.Save()
+			if (err == nil && len(item.expectedErr) > 0) ||
+				(err != nil && err.(*FieldError).Err.Error() != item.expectedErr) {
+
+				t.Errorf("Item %d, “%s”: unexpected save error with concurrency %d. Expecting “%s”; found “%v”",
+					i, item.description, concurrency, item.expectedErr, err)
+			}
+
+			var reloaded config
+			r := Client{
+				etcdClient: mock,
+				config:     reflect.ValueOf(&reloaded),
+				info:       make(map[string]info),
+			}
+			r.SetConcurrency(concurrency)
+
+			err = r.Load()
+			if (err == nil && len(item.expectedErr) > 0) ||
+				(err != nil && err.(*FieldError).Err.Error() != item.expectedErr) {
+
+				t.Errorf("Item %d, “%s”: unexpected load error with concurrency %d. Expecting “%s”; found “%v”",
+					i, item.description, concurrency, item.expectedErr, err)
+			}
+
+			results = append(results, mock)
+			written = append(written, paths)
+			loaded = append(loaded, reloaded)
+		}
+
+		if len(item.expectedErr) > 0 {
+			continue
+		}
+
+		if !equalNodes(results[0].root, results[1].root) {
+			t.Errorf("Item %d, “%s”: nodes mismatch. Expecting “%s”; found “%s”",
+				i, item.description, printNode(results[0].root), printNode(results[1].root))
+		}
+
+		if !reflect.DeepEqual(written[0], written[1]) {
+			t.Errorf("Item %d, “%s”: written paths mismatch. Expecting “%v”; found “%v”",
+				i, item.description, written[0], written[1])
+		}
+
+		if !reflect.DeepEqual(loaded[0], original) || !reflect.DeepEqual(loaded[1], original) {
+			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, original, loaded[1])
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	c := Client{
+		etcdClient: NewClientMock(),
+		info:       make(map[string]info),
+	}
+	c.SetConcurrency(2)
+
+	var lock sync.Mutex
+	var started []int
+
+	tasks := make([]func() error, 10)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() error {
+			lock.Lock()
+			started = append(started, i)
+			lock.Unlock()
+
+			switch i {
+			case 0:
+				return fmt.Errorf("error 1")
+			case 1:
+				// still running when the first task fails
+				time.Sleep(50 * time.Millisecond)
+				return fmt.Errorf("error 2")
+			}
+			return nil
+		}
+	}
+
+	if err := c.parallel(tasks); err == nil || err.Error() != "error 1" {
+		t.Errorf("Expecting the error of the first task; found “%v”", err)
+	}
+
+	// the second task could start before or after the failure
+	sort.Ints(started)
+	if !reflect.DeepEqual(started, []int{0}) && !reflect.DeepEqual(started, []int{0, 1}) {
+		t.Errorf("Tasks started after the failure. Found “%v”", started)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	etcdData := etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1"},
+			{Key: "/field2", Value: "10"},
+			{
+				Key: "/field3",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field3/key1", Value: "value1"},
+					{Key: "/field3/key2", Value: "value2"},
+				},
+			},
+		},
+	}
+
+	config := struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+	}{
+		Field1: "value1 modified",
+		Field2: 10,
+		Field3: map[string]string{
+			"key1": "value1",
+			"key3": "value3",
+		},
+		Field4: []string{"value4"},
+	}
+
+	data := []struct {
+		description string      // describe the test case
+		field       interface{} // field to plan (whole configuration when nil)
+		expectedErr bool        // error expectation when planning
+		expected    []Operation // operations that would be sent to etcd
+	}{
+		{
+			description: "it should plan the whole configuration",
+			expected: []Operation{
+				{Type: OperationSet, Path: "/field1", OldValue: "value1", NewValue: "value1 modified"},
+				{Type: OperationSet, Path: "/field3/key3", NewValue: "value3"},
+				{Type: OperationDelete, Path: "/field3/key2", OldValue: "value2"},
+				{Type: OperationCreateDir, Path: "/field4"},
+				{Type: OperationAppend, Path: "/field4", NewValue: "value4"},
+			},
+		},
+		{
+			description: "it should plan a specific field",
+			field:       &config.Field1,
+			expected: []Operation{
+				{Type: OperationSet, Path: "/field1", OldValue: "value1", NewValue: "value1 modified"},
+			},
+		},
+		{
+			description: "it should plan nothing for a field that didn't change",
+			field:       &config.Field2,
+		},
+		{
+			description: "it should fail when etcd rejects a get",
+			field:       &config.Field3,
+			expectedErr: true,
+		},
+		{
+			description: "it should fail to plan a non-addressable field",
+			field:       config.Field1,
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestPlan for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcdData
+		mock.getErrors["/field3"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&config),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		var operations []Operation
+		var err error
+
+		if item.field == nil {
+			delete(mock.getErrors, "/field3")
+			operations, err = c.Plan()
+		} else {
+			operations, err = c.PlanField(item.field)
+		}
+
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		for j := range operations {
+			operations[j].field = reflect.Value{}
+		}
+
+		if !item.expectedErr && !reflect.DeepEqual(operations, item.expected) {
+			t.Errorf("Item %d, “%s”: operations mismatch. Expecting “%v”; found “%v”",
+				i, item.description, item.expected, operations)
+		}
+
+		if mock.etcdIndex != 0 {
+			t.Errorf("Item %d, “%s”: etcd was modified while planning", i, item.description)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+	}
+
+	data := []struct {
+		description string                    // describe the test case
+		change      func(*config)             // change in the configuration after loading it
+		field       func(*config) interface{} // field to preview (whole configuration when nil)
+		expected    []Operation               // operations that would be sent to etcd
+	}{
+		{
+			description: "it should ignore changes made in etcd after the load",
+			change:      func(cfg *config) {},
+		},
+		{
+			description: "it should preview the changes of the configuration",
+			change: func(cfg *config) {
+				cfg.Field2 = 20
+				delete(cfg.Field3, "key1")
+			},
+			expected: []Operation{
+				{Type: OperationSet, Path: "/field2", OldValue: "10", NewValue: "20"},
+				{Type: OperationDelete, Path: "/field3/key1", OldValue: "value1"},
+			},
+		},
+		{
+			description: "it should preview the changes of a specific field",
+			change: func(cfg *config) {
+				cfg.Field1 = "value1 modified"
+				cfg.Field2 = 20
+			},
+			field: func(cfg *config) interface{} {
+				return &cfg.Field1
+			},
+			expected: []Operation{
+				{Type: OperationSet, Path: "/field1", OldValue: "value1", NewValue: "value1 modified"},
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestPending for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field1", Value: "value1"},
+				{Key: "/field2", Value: "10"},
+				{
+					Key: "/field3",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field3/key1", Value: "value1"},
+					},
+				},
+			},
+		}
+
+		var cfg config
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		if err := c.Load(); err != nil {
+			t.Fatalf("Unexpected error loading the configuration. %s", err)
+		}
+
+		// Someone else changes etcd, that isn't seen by Save
+		if _, err := mock.Set("/field1", "external", 0); err != nil {
+			t.Fatalf("Unexpected error changing etcd. %s", err)
+		}
+
+		item.change(&cfg)
+
+		var operations []Operation
+		var written []string
+		var err error
+
+		if item.field == nil {
+			operations = c.Pending()
+			written, err = c.Save()
+
+		} else if operations, err = c.PendingField(item.field(&cfg)); err == nil {
+			written, err = c.SaveField(item.field(&cfg))
+		}
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		var paths []string
+		for j := range operations {
+			paths = append(paths, operations[j].Path)
+			operations[j].field = reflect.Value{}
+		}
+
+		if !reflect.DeepEqual(operations, item.expected) {
+			t.Errorf("Item %d, “%s”: operations mismatch. Expecting “%v”; found “%v”",
+				i, item.description, item.expected, operations)
+		}
+
+		if !reflect.DeepEqual(paths, written) {
+			t.Errorf("Item %d, “%s”: preview doesn't match the save. Expecting “%v”; found “%v”",
+				i, item.description, paths, written)
+		}
+	}
+
+	var cfg config
+	c := Client{
+		etcdClient: NewClientMock(),
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+
+	if _, err := c.PendingField(cfg.Field1); err != ErrFieldNotAddr {
+		t.Errorf("Expecting field not addressable error; found “%v”", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	data := []struct {
+		description string            // describe the test case
+		init        func(*clientMock) // initial configuration of the mocked client (if necessary)
+		etcdData    etcd.Node         // etcd state before loading the configuration
+		namespace   string            // namespace of the configuration in the etcd
+		config      interface{}       // configuration structure (used to detect what we need to look for in etcd)
+		expectedErr bool              // error expectation when loading the configuration
+		expected    interface{}       // configuration instance expected after loading
+	}{
+		{
+			description: "it should load an one-level configuration ignoring not tagged or invalid tag fields",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field1",
+						Value: "value1",
+					},
+					{
+						Key:   "/field2",
+						Value: "10",
+					},
+					{
+						Key:   "/field3",
+						Value: "20",
+					},
+					{
+						Key:   "/field4",
+						Value: "true",
+					},
+				},
+			},
+			config: &struct {
+				Field1 string `etcd:"/field1"`
+				Field2 int    `etcd:"field2/"`
+				Field3 int64  `etcd:"/field3/"`
+				Field4 bool   `etcd:"//field4//"`
+				Extra1 string
+				Extra2 string `etcd:"///"`
+			}{},
+			expected: struct {
+				Field1 string `etcd:"/field1"`
+				Field2 int    `etcd:"field2/"`
+				Field3 int64  `etcd:"/field3/"`
+				Field4 bool   `etcd:"//field4//"`
+				Extra1 string
+				Extra2 string `etcd:"///"`
+			}{
+				Field1: "value1",
+				Field2: 10,
+				Field3: 20,
+				Field4: true,
+			},
+		},
+		{
+			description: "it should load an embedded structure",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/subfield1",
+								Value: "10",
+							},
+							{
+								Key:   "/field/subfield2",
+								Value: "20",
+							},
+							{
+								Key:   "/field/subfield3",
+								Value: "false",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field1 struct {
+					Subfield1 int   `etcd:"subfield1"`
+					Subfield2 int64 `etcd:"subfield2"`
+					Subfield3 bool  `etcd:"subfield3"`
+				} `etcd:"field"`
+			}{},
+			expected: struct {
+				Field1 struct {
+					Subfield1 int   `etcd:"subfield1"`
+					Subfield2 int64 `etcd:"subfield2"`
+					Subfield3 bool  `etcd:"subfield3"`
+				} `etcd:"field"`
+			}{
+				Field1: struct {
+					Subfield1 int   `etcd:"subfield1"`
+					Subfield2 int64 `etcd:"subfield2"`
+					Subfield3 bool  `etcd:"subfield3"`
+				}{
+					Subfield1: 10,
+					Subfield2: 20,
+					Subfield3: false,
+				},
+			},
+		},
+		{
+			description: "it should load a slice of strings",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/0",
+								Value: "value1",
+							},
+							{
+								Key:   "/field/1",
+								Value: "value2",
+							},
+							{
+								Key:   "/field/2",
+								Value: "value3",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []string `etcd:"field"`
+			}{},
+			expected: struct {
+				Field []string `etcd:"field"`
+			}{
+				Field: []string{"value1", "value2", "value3"},
+			},
+		},
+		{
+			description: "it should load a slice of int",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/0",
+								Value: "10",
+							},
+							{
+								Key:   "/field/1",
+								Value: "20",
+							},
+							{
+								Key:   "/field/2",
+								Value: "30",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []int `etcd:"field"`
+			}{},
+			expected: struct {
+				Field []int `etcd:"field"`
+			}{
+				Field: []int{10, 20, 30},
+			},
+		},
+		{
+			description: "it should load a slice of int64",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/0",
+								Value: "10",
+							},
+							{
+								Key:   "/field/1",
+								Value: "20",
+							},
+							{
+								Key:   "/field/2",
+								Value: "30",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []int64 `etcd:"field"`
+			}{},
+			expected: struct {
+				Field []int64 `etcd:"field"`
+			}{
+				Field: []int64{10, 20, 30},
+			},
+		},
+		{
+			description: "it should load a slice of bool",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/0",
+								Value: "true",
+							},
+							{
+								Key:   "/field/1",
+								Value: "false",
+							},
+							{
+								Key:   "/field/2",
+								Value: "true",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []bool `etcd:"field"`
+			}{},
+			expected: struct {
+				Field []bool `etcd:"field"`
+			}{
+				Field: []bool{true, false, true},
+			},
+		},
+		{
+			description: "it should load a slice of structures",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field/0",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/0/subfield1",
+										Value: "10",
+									},
+									{
+										Key:   "/field/0/subfield2",
+										Value: "20",
+									},
+									{
+										Key:   "/field/0/subfield3",
+										Value: "false",
+									},
+								},
+							},
+							{
+								Key: "/field/1",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/1/subfield1",
+										Value: "20",
+									},
+									{
+										Key:   "/field/1/subfield2",
+										Value: "40",
+									},
+									{
+										Key:   "/field/1/subfield3",
+										Value: "true",
+									},
+								},
+							},
+							{
+								Key: "/field/2",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/2/subfield1",
+										Value: "40",
+									},
+									{
+										Key:   "/field/2/subfield2",
+										Value: "80",
+									},
+									{
+										Key:   "/field/2/subfield3",
+										Value: "false",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []struct {
+					Subfield0 string
+					Subfield1 int   `etcd:"subfield1"`
+					Subfield2 int64 `etcd:"subfield2"`
+					Subfield3 bool  `etcd:"subfield3"`
+				} `etcd:"field"`
+			}{},
+			expected: struct {
+				Field []struct {
+					Subfield0 string
+					Subfield1 int   `etcd:"subfield1"`
+					Subfield2 int64 `etcd:"subfield2"`
+					Subfield3 bool  `etcd:"subfield3"`
+				} `etcd:"field"`
+			}{
+				Field: []struct {
+					Subfield0 string
+					Subfield1 int   `etcd:"subfield1"`
+					Subfield2 int64 `etcd:"subfield2"`
+					Subfield3 bool  `etcd:"subfield3"`
+				}{
+					{
+						Subfield1: 10,
+						Subfield2: 20,
+						Subfield3: false,
+					},
+					{
+						Subfield1: 20,
+						Subfield2: 40,
+						Subfield3: true,
+					},
+					{
+						Subfield1: 40,
+						Subfield2: 80,
+						Subfield3: false,
+					},
+				},
+			},
+		},
+		{
+			description: "it should load a map of string to string",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/subfield1",
+								Value: "value1",
+							},
+							{
+								Key:   "/field/subfield2",
+								Value: "value2",
+							},
+							{
+								Key:   "/field/subfield3",
+								Value: "value3",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field map[string]string `etcd:"field"`
+			}{},
+			expected: struct {
+				Field map[string]string `etcd:"field"`
+			}{
+				Field: map[string]string{
+					"subfield1": "value1",
+					"subfield2": "value2",
+					"subfield3": "value3",
+				},
+			},
+		},
+		{
+			description: "it should load a map of string to struct",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field/key1",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/key1/subfield1",
+										Value: "value1",
+									},
+									{
+										Key:   "/field/key1/subfield2",
+										Value: "10",
+									},
+								},
+							},
+							{
+								Key: "/field/key2",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/key2/subfield1",
+										Value: "value2",
+									},
+									{
+										Key:   "/field/key2/subfield2",
+										Value: "20",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field map[string]struct {
+					Subfield1 string `etcd:"subfield1"`
+					Subfield2 int    `etcd:"subfield2"`
+				} `etcd:"field"`
+			}{},
+			expected: struct {
+				Field map[string]struct {
+					Subfield1 string `etcd:"subfield1"`
+					Subfield2 int    `etcd:"subfield2"`
+				} `etcd:"field"`
+			}{
+				Field: map[string]struct {
+					Subfield1 string `etcd:"subfield1"`
+					Subfield2 int    `etcd:"subfield2"`
+				}{
+					"key1": struct {
+						Subfield1 string `etcd:"subfield1"`
+						Subfield2 int    `etcd:"subfield2"`
+					}{
+						Subfield1: "value1",
+						Subfield2: 10,
+					},
+					"key2": struct {
+						Subfield1 string `etcd:"subfield1"`
+						Subfield2 int    `etcd:"subfield2"`
+					}{
+						Subfield1: "value2",
+						Subfield2: 20,
+					},
+				},
+			},
+		},
+		{
+			description: "it should fail to load a non-pointer to structure",
+			config:      123,
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects a get string",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field string `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects a get int",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field int `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects a get int64",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field int64 `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd returns a number with an invalid format",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "NaN",
+					},
+				},
+			},
+			config: &struct {
+				Field int `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects a get bool",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field bool `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get a structure field",
+			init: func(c *clientMock) {
+				c.getErrors["/field/subfield"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field struct {
+					Subfield int `etcd:"subfield"`
+				} `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get a slice of structure",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field []struct {
+					Subfield int `etcd:"subfield"`
+				} `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd returns corrupted data in a structure of a slice",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field/0",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/0/subfield",
+										Value: "NaN",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []struct {
+					Subfield int `etcd:"subfield"`
+				} `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get the slice of strings",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field []string `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get the slice of int",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field []int `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd returns an invalid int in a slice",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/0",
+								Value: "NaN",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []int `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get the slice of int64",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field []int64 `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd returns an invalid int64 in a slice",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/field/0",
+								Value: "NaN",
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field []int64 `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get the slice of bool",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field []bool `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd rejects to get a map",
+			init: func(c *clientMock) {
+				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			config: &struct {
+				Field map[string]string `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd returns a corrupted data for a struct in a map",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field/key1",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/key1/subfield1",
+										Value: "value1",
+									},
+									{
+										Key:   "/field/key1/subfield2",
+										Value: "NaN",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field map[string]struct {
+					Subfield1 string `etcd:"subfield1"`
+					Subfield2 int    `etcd:"subfield2"`
+				} `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd data is corrupted",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field/subfield",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/subfield/subsubfield2",
+										Value: "NaN",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field struct {
+					Subfield struct {
+						Subsubfield1 string
+						Subsubfield2 int `etcd:"subsubfield2"`
+					} `etcd:"subfield"`
+				} `etcd:"field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should load correctly when using namespaces",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/test",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key:   "/test/field1",
+								Value: "value1",
+							},
+							{
+								Key:   "/test/field2",
+								Value: "10",
+							},
+							{
+								Key:   "/test/field3",
+								Value: "20",
+							},
+							{
+								Key:   "/test/field4",
+								Value: "true",
+							},
+						},
+					},
+				},
+			},
+			namespace: "test",
+			config: &struct {
+				Field1 string `etcd:"field1"`
+				Field2 int    `etcd:"field2"`
+				Field3 int64  `etcd:"field3"`
+				Field4 bool   `etcd:"field4"`
 			}{},
 			expected: struct {
-				Field []struct {
-					Subfield0 string
-					Subfield1 int   `etcd:"subfield1"`
-					Subfield2 int64 `etcd:"subfield2"`
-					Subfield3 bool  `etcd:"subfield3"`
-				} `etcd:"field"`
+				Field1 string `etcd:"field1"`
+				Field2 int    `etcd:"field2"`
+				Field3 int64  `etcd:"field3"`
+				Field4 bool   `etcd:"field4"`
 			}{
-				Field: []struct {
-					Subfield0 string
-					Subfield1 int   `etcd:"subfield1"`
-					Subfield2 int64 `etcd:"subfield2"`
-					Subfield3 bool  `etcd:"subfield3"`
-				}{
+				Field1: "value1",
+				Field2: 10,
+				Field3: 20,
+				Field4: true,
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoad for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &item.etcdData
+
+		c := Client{
+			etcdClient: mock,
+			namespace:  item.namespace,
+			config:     reflect.ValueOf(item.config),
+			info:       make(map[string]info),
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		err := c.Load()
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !item.expectedErr && reflect.DeepEqual(item.config, item.expected) {
+			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, item.config)
+		}
+	}
+}
+
+func TestLoadNamespace(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []int64           `etcd:"field4"`
+	}
+
+	data := []struct {
+		description string            // describe the test case
+		init        func(*clientMock) // initial configuration of the mocked client (if necessary)
+		etcdData    etcd.Node         // etcd state before loading the configuration
+		namespace   string            // namespace of the configuration in the etcd
+		expectedErr bool              // error expectation when loading the configuration
+		expected    config            // configuration expected after loading
+	}{
+		{
+			description: "it should load the whole namespace in a single request",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/test",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/test/field1", Value: "value1"},
+							{Key: "/test/field2", Value: "10"},
+							{
+								Key: "/test/field3",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{Key: "/test/field3/key1", Value: "value1"},
+								},
+							},
+							{
+								Key: "/test/field4",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{Key: "/test/field4/0", Value: "100"},
+								},
+							},
+						},
+					},
+				},
+			},
+			namespace: "test",
+			expected: config{
+				Field1: "value1",
+				Field2: 10,
+				Field3: map[string]string{"key1": "value1"},
+				Field4: []int64{100},
+			},
+		},
+		{
+			description: "it should load the root when there's no namespace",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field1", Value: "value1"},
+				},
+			},
+			expected: config{
+				Field1: "value1",
+			},
+		},
+		{
+			description: "it should fail when etcd rejects the namespace get",
+			init: func(c *clientMock) {
+				c.getErrors["/test"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			},
+			namespace:   "test",
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd returns an invalid number",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field2", Value: "NaN"},
+				},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadNamespace for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &item.etcdData
+		mock.etcdIndex = 1000
+
+		// Requests for the fields must not be sent
+		for _, field := range []string{"field1", "field2", "field3", "field4"} {
+			mock.getErrors[item.namespace+"/"+field] = fmt.Errorf("unexpected request")
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		var cfg config
+		c := Client{
+			etcdClient: mock,
+			namespace:  item.namespace,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+		c.SetLoadMode(LoadNamespace)
+
+		err := c.Load()
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if item.expectedErr {
+			continue
+		}
+
+		if !reflect.DeepEqual(cfg, item.expected) {
+			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, cfg)
+		}
+
+		if c.Index() != mock.etcdIndex {
+			t.Errorf("Item %d, “%s”: index mismatch. Expecting “%d”; found “%d”",
+				i, item.description, mock.etcdIndex, c.Index())
+		}
+	}
+}
+
+func TestLoadField(t *testing.T) {
+	config := struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+		Field5 struct {
+			Subfield1 string `etcd:"subfield1"`
+			Subfield2 bool   `etcd:"subfield2"`
+		} `etcd:"field5"`
+		Extra string
+	}{
+		Field1: "not loaded",
+	}
+
+	etcdData := etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1", ModifiedIndex: 10},
+			{Key: "/field2", Value: "20", ModifiedIndex: 20},
+			{
+				Key:           "/field3",
+				Dir:           true,
+				ModifiedIndex: 30,
+				Nodes: etcd.Nodes{
+					{Key: "/field3/key1", Value: "value1", ModifiedIndex: 31},
+				},
+			},
+			{
+				Key:           "/field4",
+				Dir:           true,
+				ModifiedIndex: 40,
+				Nodes: etcd.Nodes{
+					{Key: "/field4/0", Value: "value1", ModifiedIndex: 41},
+					{Key: "/field4/1", Value: "value2", ModifiedIndex: 42},
+				},
+			},
+			{
+				Key:           "/field5",
+				Dir:           true,
+				ModifiedIndex: 50,
+				Nodes: etcd.Nodes{
+					{Key: "/field5/subfield1", Value: "subvalue1", ModifiedIndex: 51},
+					{Key: "/field5/subfield2", Value: "true", ModifiedIndex: 52},
+				},
+			},
+		},
+	}
+
+	data := []struct {
+		description     string      // describe the test case
+		field           interface{} // field to load
+		expectedErr     bool        // error expectation when loading the field
+		expected        interface{} // value expected in the field after loading
+		expectedVersion uint64      // version expected for the field after loading
+	}{
+		{
+			description:     "it should load an int field",
+			field:           &config.Field2,
+			expected:        20,
+			expectedVersion: 20,
+		},
+		{
+			description:     "it should load a map field",
+			field:           &config.Field3,
+			expected:        map[string]string{"key1": "value1"},
+			expectedVersion: 30,
+		},
+		{
+			description:     "it should load a slice field",
+			field:           &config.Field4,
+			expected:        []string{"value1", "value2"},
+			expectedVersion: 40,
+		},
+		{
+			description: "it should load a structure field",
+			field:       &config.Field5,
+			expected: struct {
+				Subfield1 string `etcd:"subfield1"`
+				Subfield2 bool   `etcd:"subfield2"`
+			}{
+				Subfield1: "subvalue1",
+				Subfield2: true,
+			},
+			expectedVersion: 50,
+		},
+		{
+			description: "it should fail to load a field not mapped",
+			field:       &config.Extra,
+			expectedErr: true,
+		},
+		{
+			description: "it should fail to load a non-addressable field",
+			field:       config.Field1,
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadField for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcdData
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&config),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		err := c.LoadField(item.field)
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if item.expectedErr {
+			continue
+		}
+
+		value := reflect.ValueOf(item.field).Elem()
+		if !reflect.DeepEqual(value.Interface(), item.expected) {
+			t.Errorf("Item %d, “%s”: field mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, value.Interface())
+		}
+
+		if version, err := c.Version(item.field); err != nil || version != item.expectedVersion {
+			t.Errorf("Item %d, “%s”: version mismatch. Expecting “%d”; found “%d” (%v)",
+				i, item.description, item.expectedVersion, version, err)
+		}
+
+		if config.Field1 != "not loaded" {
+			t.Errorf("Item %d, “%s”: other fields were loaded", i, item.description)
+		}
+	}
+}
+
+func TestLoadAt(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+	}
+
+	var cfg config
+	mock := NewClientMock()
+
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+
+	// Build the history of the configuration, storing the index of each state
+	states := []func(){
+		func() {
+			cfg.Field1 = "value1"
+			cfg.Field2 = 10
+			cfg.Field3 = map[string]string{"key1": "value1", "key2": "value2"}
+			cfg.Field4 = []string{"value1", "value2"}
+		},
+		func() {
+			cfg.Field1 = "value1 modified"
+			delete(cfg.Field3, "key1")
+			cfg.Field4 = []string{"value1", "value2 modified", "value3"}
+		},
+		func() {
+			cfg.Field3["key2"] = "value2 modified"
+		},
+		func() {
+			// removed after the last change of the current keys
+			delete(cfg.Field3, "key2")
+		},
+	}
+
+	c.SetHistoryTimeout(10 * time.Millisecond)
+
+	var indexes []uint64
+	var configs []config
+
+	for _, state := range states {
+		state()
+
+		if _, err := c.Save(); err != nil {
+			// We are not testing save errors here, so make it fatal
+			t.Fatalf("Unexpected error. %s", err.Error())
+		}
+
+		saved := cfg
+		saved.Field3 = make(map[string]string)
+		for key, value := range cfg.Field3 {
+			saved.Field3[key] = value
+		}
+		saved.Field4 = append([]string(nil), cfg.Field4...)
+
+		indexes = append(indexes, mock.etcdIndex)
+		configs = append(configs, saved)
+	}
+
+	version, err := c.Version(&cfg.Field1)
+	if err != nil {
+		t.Fatalf("Unexpected error. %s", err.Error())
+	}
+
+	for i := range indexes {
+		var old config
+		if err := c.LoadAt(&old, indexes[i]); err != nil {
+			t.Errorf("Item %d: unexpected error. %s", i, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(old, configs[i]) {
+			t.Errorf("Item %d: config mismatch. Expecting “%+v”; found “%+v”", i, configs[i], old)
+		}
+
+		var field1 string
+		if err := c.LoadFieldAt(&cfg.Field1, indexes[i], &field1); err != nil {
+			t.Errorf("Item %d: unexpected error. %s", i, err.Error())
+
+		} else if field1 != configs[i].Field1 {
+			t.Errorf("Item %d: field mismatch. Expecting “%s”; found “%s”", i, configs[i].Field1, field1)
+		}
+	}
+
+	if !reflect.DeepEqual(cfg, configs[len(configs)-1]) {
+		t.Errorf("Live configuration was modified. Expecting “%+v”; found “%+v”",
+			configs[len(configs)-1], cfg)
+	}
+
+	if v, err := c.Version(&cfg.Field1); err != nil || v != version {
+		t.Errorf("Live version was modified. Expecting “%d”; found “%d”", version, v)
+	}
+
+	// The history timeout is waited once for the whole configuration, not once per field
+	c.SetHistoryTimeout(100 * time.Millisecond)
+	start := time.Now()
+
+	var old config
+	if err := c.LoadAt(&old, indexes[0]); err != nil {
+		t.Errorf("Unexpected error. %s", err.Error())
+
+	} else if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("History timeout waited for each field. Loaded in %s", elapsed)
+	}
+
+	var field2 string
+	if err := c.LoadFieldAt(&cfg.Field2, indexes[0], &field2); err != ErrInvalidTarget {
+		t.Errorf("Expecting invalid target error; found “%v”", err)
+	}
+
+	if err := c.LoadAt(cfg, indexes[0]); err != ErrInvalidTarget {
+		t.Errorf("Expecting invalid target error; found “%v”", err)
+	}
+}
+
+func TestLint(t *testing.T) {
+	type config struct {
+		Field1 string `etcd:"field1"`
+		Field2 struct {
+			Subfield1 int `etcd:"subfield1"`
+		} `etcd:"field2"`
+		Field3 map[string]struct {
+			Subfield1 string `etcd:"subfield1"`
+		} `etcd:"field3"`
+		Field4 []string `etcd:"field4"`
+	}
+
+	data := []struct {
+		description string    // describe the test case
+		etcdData    etcd.Node // etcd state before checking the configuration
+		namespace   string    // namespace of the configuration in the etcd
+		expected    []string  // unknown keys expected
+	}{
+		{
+			description: "it should not report anything when all keys match",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field1", Value: "value1"},
+					{
+						Key: "/field2",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field2/subfield1", Value: "10"},
+						},
+					},
+					{
+						Key: "/field3",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field3/key1",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{Key: "/field3/key1/subfield1", Value: "value1"},
+								},
+							},
+						},
+					},
+					{
+						Key: "/field4",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field4/0", Value: "value1"},
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "it should report keys that don't match any field",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/fieldl", Value: "value1"},
+					{
+						Key: "/field2",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field2/subfeld1", Value: "10"},
+						},
+					},
+					{
+						Key: "/field3",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field3/key1",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{Key: "/field3/key1/subfield2", Value: "value1"},
+								},
+							},
+						},
+					},
+					{
+						Key: "/field4",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field4/0",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{Key: "/field4/0/value", Value: "value1"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: []string{"/field2/subfeld1", "/field3/key1/subfield2", "/field4/0/value", "/fieldl"},
+		},
+		{
+			description: "it should report keys in the namespace",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/test",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/test/field1", Value: "value1"},
+							{Key: "/test/timout", Value: "10"},
+						},
+					},
+					{Key: "/other", Value: "other configuration"},
+				},
+			},
+			namespace: "test",
+			expected:  []string{"/test/timout"},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLint for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &item.etcdData
+
+		var cfg config
+		c := Client{
+			etcdClient: mock,
+			namespace:  item.namespace,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		unknown, err := c.Lint()
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(unknown, item.expected) {
+			t.Errorf("Item %d, “%s”: unknown keys mismatch. Expecting “%v”; found “%v”",
+				i, item.description, item.expected, unknown)
+		}
+
+		// Strict load must report the same keys in all modes
+		c.SetStrict(true)
+
+		for _, mode := range []LoadMode{LoadFields, LoadNamespace} {
+			c.SetLoadMode(mode)
+
+			err := c.Load()
+			if len(item.expected) == 0 {
+				if _, ok := err.(*UnknownKeysError); ok {
+					t.Errorf("Item %d, “%s”: unexpected strict error in mode %d. %s",
+						i, item.description, mode, err.Error())
+				}
+				continue
+			}
+
+			if unknownErr, ok := err.(*UnknownKeysError); !ok {
+				t.Errorf("Item %d, “%s”: strict error expected in mode %d. Found “%v”",
+					i, item.description, mode, err)
+
+			} else if !reflect.DeepEqual(unknownErr.Keys, item.expected) {
+				t.Errorf("Item %d, “%s”: unknown keys mismatch in mode %d. Expecting “%v”; found “%v”",
+					i, item.description, mode, item.expected, unknownErr.Keys)
+			}
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	type config struct {
+		Field1 int `etcd:"field1"`
+		Field2 struct {
+			Subfield1 bool   `etcd:"subfield1"`
+			Subfield2 string `etcd:"subfield2"`
+		} `etcd:"field2"`
+		Field3 []int64 `etcd:"field3"`
+	}
+
+	data := []struct {
+		description string       // describe the test case
+		etcdData    etcd.Node    // etcd state before loading the configuration
+		expected    []FieldError // errors expected, without the underlying error
+	}{
+		{
+			description: "it should report all values that cannot be converted",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field1", Value: "abc"},
+					{
+						Key: "/field2",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field2/subfield1", Value: "maybe"},
+							{Key: "/field2/subfield2", Value: "value"},
+						},
+					},
+					{
+						Key: "/field3",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field3/0", Value: "1"},
+							{Key: "/field3/1", Value: "1.5"},
+						},
+					},
+				},
+			},
+			expected: []FieldError{
+				{Path: "/field1", Value: "abc", Type: reflect.TypeOf(0)},
+				{Path: "/field2/subfield1", Value: "maybe", Type: reflect.TypeOf(false)},
+				{Path: "/field3/1", Value: "1.5", Type: reflect.TypeOf(int64(0))},
+			},
+		},
+		{
+			description: "it should report the path that couldn't be retrieved",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field1", Value: "10"},
+					{
+						Key: "/field2",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field2/subfield1", Value: "true"},
+						},
+					},
+				},
+			},
+			expected: []FieldError{
+				{Path: "/field3", Type: reflect.TypeOf([]int64{})},
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadErrors for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &item.etcdData
+
+		var cfg config
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		var errs Errors
+		switch err := c.Load().(type) {
+		case Errors:
+			errs = err
+		case nil:
+		default:
+			errs = Errors{err}
+		}
+
+		if len(errs) != len(item.expected) {
+			t.Errorf("Item %d, “%s”: unexpected number of errors. Expecting “%d”; found “%d” (%v)",
+				i, item.description, len(item.expected), len(errs), errs)
+			continue
+		}
+
+		for j, err := range errs {
+			fieldErr, ok := err.(*FieldError)
+			if !ok {
+				t.Errorf("Item %d, “%s”: error %d isn't a field error. Found “%v”",
+					i, item.description, j, err)
+				continue
+			}
+
+			if fieldErr.Err == nil {
+				t.Errorf("Item %d, “%s”: error %d without the underlying error", i, item.description, j)
+			}
+
+			expected := item.expected[j]
+			expected.Err = fieldErr.Err
+
+			if !reflect.DeepEqual(*fieldErr, expected) {
+				t.Errorf("Item %d, “%s”: error %d mismatch. Expecting “%v”; found “%v”",
+					i, item.description, j, expected, *fieldErr)
+			}
+		}
+	}
+}
+
+func TestLoadBool(t *testing.T) {
+	type config struct {
+		Field bool `etcd:"field"`
+	}
+
+	aliases := map[string]bool{
+		"Yes": true,
+		"on":  true,
+		"no":  false,
+		"OFF": false,
+	}
+
+	data := []struct {
+		description string // describe the test case
+		value       string // value stored in etcd
+		expected    bool   // value expected in the field
+		expectedErr bool   // error expectation when loading the configuration
+	}{
+		{description: "it should load the values written by the library", value: "true", expected: true},
+		{description: "it should accept numeric values", value: "1", expected: true},
+		{description: "it should accept numeric false values", value: "0", expected: false},
+		{description: "it should accept capitalized values", value: "True", expected: true},
+		{description: "it should accept short values", value: "F", expected: false},
+		{description: "it should accept aliases", value: "yes", expected: true},
+		{description: "it should accept aliases in any case", value: "ON", expected: true},
+		{description: "it should accept false aliases", value: "Off", expected: false},
+		{description: "it should fail with unknown values", value: "maybe", expectedErr: true},
+		{description: "it should fail with empty values", value: "", expectedErr: true},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadBool for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field", Value: item.value},
+			},
+		}
+
+		// Start with the opposite value to detect fields that weren't touched
+		cfg := config{Field: !item.expected}
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+		c.SetBoolAliases(aliases)
+
+		err := c.Load()
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if item.expectedErr {
+			if errs, ok := err.(Errors); !ok || len(errs) != 1 {
+				t.Errorf("Item %d, “%s”: unexpected error type. Found “%v”", i, item.description, err)
+			} else if fieldErr, ok := errs[0].(*FieldError); !ok || fieldErr.Value != item.value {
+				t.Errorf("Item %d, “%s”: unexpected field error. Found “%v”", i, item.description, errs[0])
+			}
+			continue
+		}
+
+		if cfg.Field != item.expected {
+			t.Errorf("Item %d, “%s”: value mismatch. Expecting “%t”; found “%t”",
+				i, item.description, item.expected, cfg.Field)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	type config struct {
+		Field1 string `etcd:"field1" default:"value0"`
+		Field2 int    `etcd:"field2"`
+		Field3 struct {
+			Subfield1 int    `etcd:"subfield1" default:"5"`
+			Subfield2 string `etcd:"subfield2"`
+		} `etcd:"field3"`
+		Field4 Value[time.Duration] `etcd:"field4" default:"1m"`
+		Field5 struct {
+			Subfield1 bool              `etcd:"subfield1" default:"true"`
+			Subfield2 map[string]string `etcd:"subfield2"`
+		} `etcd:"field5"`
+	}
+
+	data := []struct {
+		description string   // describe the test case
+		mode        LoadMode // how the configuration is retrieved
+	}{
+		{description: "it should fill the missing fields with the defaults", mode: LoadFields},
+		{description: "it should fill the missing fields of the namespace with the defaults", mode: LoadNamespace},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadDefaults for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field2", Value: "10"},
+				{
+					Key: "/field3",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field3/subfield2", Value: "value2"},
+					},
+				},
+			},
+		}
+
+		var cfg config
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+		c.SetLoadMode(item.mode)
+
+		if err := c.Load(); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if cfg.Field1 != "value0" || cfg.Field2 != 10 {
+			t.Errorf("Item %d, “%s”: fields mismatch. Found “%s” and “%d”",
+				i, item.description, cfg.Field1, cfg.Field2)
+		}
+
+		if cfg.Field3.Subfield1 != 5 || cfg.Field3.Subfield2 != "value2" {
+			t.Errorf("Item %d, “%s”: structure mismatch. Found “%+v”", i, item.description, cfg.Field3)
+		}
+
+		if cfg.Field4.Get() != time.Minute {
+			t.Errorf("Item %d, “%s”: Value mismatch. Found “%s”", i, item.description, cfg.Field4.Get())
+		}
+
+		if !cfg.Field5.Subfield1 || cfg.Field5.Subfield2 == nil {
+			t.Errorf("Item %d, “%s”: missing structure mismatch. Found “%+v”", i, item.description, cfg.Field5)
+		}
+
+		cfg.Field1 = "value1"
+		if err := c.LoadField(&cfg.Field1); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error loading the field. %s", i, item.description, err.Error())
+
+		} else if cfg.Field1 != "value0" {
+			t.Errorf("Item %d, “%s”: field mismatch. Found “%s”", i, item.description, cfg.Field1)
+		}
+	}
+}
+
+func TestLoadAtomic(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 struct {
+			Subfield1 string `etcd:"subfield1"`
+			Subfield2 bool   `etcd:"subfield2"`
+		} `etcd:"field4"`
+	}
+
+	etcdData := etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "new value", ModifiedIndex: 20},
+			{Key: "/field2", Value: "not a number", ModifiedIndex: 21},
+			{
+				Key:           "/field3",
+				Dir:           true,
+				ModifiedIndex: 22,
+				Nodes: etcd.Nodes{
+					{Key: "/field3/key2", Value: "new value", ModifiedIndex: 23},
+				},
+			},
+			{
+				Key:           "/field4",
+				Dir:           true,
+				ModifiedIndex: 24,
+				Nodes: etcd.Nodes{
+					{Key: "/field4/subfield1", Value: "new value", ModifiedIndex: 25},
+					{Key: "/field4/subfield2", Value: "maybe", ModifiedIndex: 26},
+				},
+			},
+		},
+	}
+
+	data := []struct {
+		description string                        // describe the test case
+		load        func(c *Client) error         // load operation that must fail
+		field       func(cfg *config) interface{} // field used to check the version
+	}{
+		{
+			description: "it should not modify any field when loading the configuration",
+			load: func(c *Client) error {
+				return c.Load()
+			},
+			field: func(cfg *config) interface{} { return &cfg.Field1 },
+		},
+		{
+			description: "it should not modify any field when loading the namespace",
+			load: func(c *Client) error {
+				c.SetLoadMode(LoadNamespace)
+				return c.Load()
+			},
+			field: func(cfg *config) interface{} { return &cfg.Field1 },
+		},
+		{
+			description: "it should not modify the subfields when loading a field",
+			load: func(c *Client) error {
+				return c.LoadField(&c.config.Interface().(*config).Field4)
+			},
+			field: func(cfg *config) interface{} { return &cfg.Field4.Subfield1 },
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadAtomic for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcdData
+
+		var cfg config
+		cfg.Field1 = "old value"
+		cfg.Field2 = 10
+		cfg.Field3 = map[string]string{"key1": "old value"}
+		cfg.Field4.Subfield1 = "old value"
+		cfg.Field4.Subfield2 = true
+
+		expected := cfg
+		expected.Field3 = map[string]string{"key1": "old value"}
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+		record(c.info, "/field1", reflect.ValueOf(&cfg.Field1).Elem(), "old value", 5)
+		record(c.info, "/field4/subfield1", reflect.ValueOf(&cfg.Field4.Subfield1).Elem(), "old value", 6)
+
+		if err := item.load(&c); err == nil {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+		}
+
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("Item %d, “%s”: configuration mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, expected, cfg)
+		}
+
+		field := item.field(&cfg)
+		if version, err := c.Version(field); err != nil || (version != 5 && version != 6) {
+			t.Errorf("Item %d, “%s”: version was modified. Found “%d” (%v)",
+				i, item.description, version, err)
+		}
+
+		if c.Index() != 0 {
+			t.Errorf("Item %d, “%s”: index was modified. Found “%d”", i, item.description, c.Index())
+		}
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{
+				Key:   "/field",
+				Value: "value",
+			},
+		},
+	}
+
+	c := Client{
+		etcdClient: mock,
+		config: reflect.ValueOf(&struct {
+			Field string `etcd:"field"`
+		}{}),
+		info: make(map[string]info),
+	}
+
+	for i := 0; i < b.N; i++ {
+		if err := c.Load(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	config := struct {
+		Field1  string            `etcd:"field1"`
+		Field2  int               `etcd:"field2"`
+		Field3  int64             `etcd:"field3"`
+		Field4  bool              `etcd:"field4"`
+		Field5  map[string]string `etcd:"field5"`
+		Field6  []string          `etcd:"field6"`
+		Field7  []int             `etcd:"field7"`
+		Field8  []int64           `etcd:"field8"`
+		Field9  []bool            `etcd:"field9"`
+		Field10 struct {
+			Subfield1 string `etcd:"subfield1"`
+			Subfield2 int    `etcd:"subfield2"`
+			Subfield3 int64  `etcd:"subfield3"`
+			Subfield4 bool   `etcd:"subfield4"`
+		} `etcd:"field10"`
+	}{}
+
+	etcdData := etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{
+				Key:   "/field1",
+				Value: "value1",
+			},
+			{
+				Key:   "/field2",
+				Value: "10",
+			},
+			{
+				Key:   "/field3",
+				Value: "20",
+			},
+			{
+				Key:   "/field4",
+				Value: "true",
+			},
+			{
+				Key: "/field5",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field5/subfield1",
+						Value: "subvalue1",
+					},
+				},
+			},
+			{
+				Key: "/field6",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field6/0",
+						Value: "subvalue1",
+					},
+					{
+						Key:   "/field6/1",
+						Value: "subvalue2",
+					},
+				},
+			},
+			{
+				Key: "/field7",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field7/0",
+						Value: "100",
+					},
+					{
+						Key:   "/field7/1",
+						Value: "200",
+					},
+				},
+			},
+			{
+				Key: "/field8",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field8/0",
+						Value: "1000",
+					},
+					{
+						Key:   "/field8/1",
+						Value: "2000",
+					},
+				},
+			},
+			{
+				Key: "/field9",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field9/0",
+						Value: "true",
+					},
 					{
-						Subfield1: 10,
-						Subfield2: 20,
-						Subfield3: false,
+						Key:   "/field9/1",
+						Value: "false",
 					},
+				},
+			},
+			{
+				Key: "/field10",
+				Dir: true,
+				Nodes: etcd.Nodes{
 					{
-						Subfield1: 20,
-						Subfield2: 40,
-						Subfield3: true,
+						Key:   "/field10/subfield1",
+						Value: "subvalue1",
 					},
 					{
-						Subfield1: 40,
-						Subfield2: 80,
-						Subfield3: false,
+						Key:   "/field10/subfield2",
+						Value: "500",
+					},
+					{
+						Key:   "/field10/subfield3",
+						Value: "800",
+					},
+					{
+						Key:   "/field10/subfield4",
+						Value: "true",
+					},
+				},
+			},
+		},
+	}
+
+	data := []struct {
+		description string            // describe the test case
+		init        func(*clientMock) // initial configuration of the mocked client (if necessary)
+		field       interface{}       // field that will be monitored for changes
+		changeValue etcd.Node         // value injected in the change
+		expectedErr bool              // error expectation when watching the configuration
+		expected    interface{}       // value expected in the field after the callback is called
+	}{
+		{
+			description: "it should watch a string field",
+			field:       &config.Field1,
+			changeValue: etcd.Node{
+				Value: "value1 modified",
+			},
+			expected: "value1 modified",
+		},
+		{
+			description: "it should watch an int field",
+			field:       &config.Field2,
+			changeValue: etcd.Node{
+				Value: "13",
+			},
+			expected: int(13),
+		},
+		{
+			description: "it should watch an int64 field",
+			field:       &config.Field3,
+			changeValue: etcd.Node{
+				Value: "27",
+			},
+			expected: int64(27),
+		},
+		{
+			description: "it should watch a bool field",
+			field:       &config.Field4,
+			changeValue: etcd.Node{
+				Value: "false",
+			},
+			expected: false,
+		},
+		{
+			description: "it should watch a map field",
+			field:       &config.Field5,
+			changeValue: etcd.Node{
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field5/subfield2",
+						Value: "subvalue2 modified",
+					},
+					{
+						Key:   "/field5/subfield3",
+						Value: "subvalue3 modified",
+					},
+				},
+			},
+			expected: map[string]string{
+				"subfield2": "subvalue2 modified",
+				"subfield3": "subvalue3 modified",
+			},
+		},
+		{
+			description: "it should watch a slice of strings",
+			field:       &config.Field6,
+			changeValue: etcd.Node{
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field6/0",
+						Value: "subvalue1 modified",
+					},
+					{
+						Key:   "/field6/1",
+						Value: "subvalue2 modified",
+					},
+				},
+			},
+			expected: []string{
+				"subvalue1 modified",
+				"subvalue2 modified",
+			},
+		},
+		{
+			description: "it should watch a slice of int",
+			field:       &config.Field7,
+			changeValue: etcd.Node{
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field7/0",
+						Value: "133",
+					},
+					{
+						Key:   "/field7/1",
+						Value: "212",
+					},
+				},
+			},
+			expected: []int{133, 212},
+		},
+		{
+			description: "it should watch a slice of int64",
+			field:       &config.Field8,
+			changeValue: etcd.Node{
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field8/0",
+						Value: "1486",
+					},
+					{
+						Key:   "/field8/1",
+						Value: "2950",
+					},
+				},
+			},
+			expected: []int64{1486, 2950},
+		},
+		{
+			description: "it should watch a slice of bool",
+			field:       &config.Field9,
+			changeValue: etcd.Node{
+				Nodes: etcd.Nodes{},
+			},
+			expected: []bool{},
+		},
+		{
+			description: "it should watch a structure",
+			field:       &config.Field10,
+			changeValue: etcd.Node{
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field10/subfield1",
+						Value: "subvalue1 modified",
+					},
+					{
+						Key:   "/field10/subfield2",
+						Value: "529",
+					},
+					{
+						Key:   "/field10/subfield3",
+						Value: "861",
+					},
+					{
+						Key:   "/field10/subfield4",
+						Value: "false",
 					},
 				},
 			},
+			expected: struct {
+				Subfield1 string `etcd:"subfield1"`
+				Subfield2 int    `etcd:"subfield2"`
+				Subfield3 int64  `etcd:"subfield3"`
+				Subfield4 bool   `etcd:"subfield4"`
+			}{
+				Subfield1: "subvalue1 modified",
+				Subfield2: int(529),
+				Subfield3: int64(861),
+				Subfield4: false,
+			},
+		},
+		{
+			description: "it should fail when watching an invalid field",
+			field:       "I'm not a valid field",
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when watching a field not registered before",
+			field:       &struct{}{},
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestWatch for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcdData
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&config),
+			info:       make(map[string]info),
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		c.preload(c.config, "")
+
+		done := make(chan bool)
+		stop, err := c.Watch(item.field, func() {
+			done <- true
+		})
+
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		mock.notifyChange(item.changeValue)
+		<-done
+		close(stop)
+
+		value := reflect.ValueOf(item.field)
+		if value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+
+		if !reflect.DeepEqual(value.Interface(), item.expected) {
+			t.Errorf("Item %d, “%s”: fields mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, item.field)
+		}
+	}
+}
+
+func TestWatchContext(t *testing.T) {
+	type config struct {
+		Field string `etcd:"field"`
+	}
+
+	data := []struct {
+		description string                                                  // describe the test case
+		watch       func(c *Client, cfg *config, called chan<- bool) func() // starts and stops the watch
+	}{
+		{
+			description: "it should stop the watch when the context is cancelled",
+			watch: func(c *Client, cfg *config, called chan<- bool) func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				done, err := c.WatchContext(ctx, &cfg.Field, func() {
+					called <- true
+				})
+
+				if err != nil {
+					t.Fatalf("unexpected error. %s", err)
+				}
+
+				return func() {
+					cancel()
+					<-done
+				}
+			},
 		},
 		{
-			description: "it should load a map of string to string",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/subfield1",
-								Value: "value1",
-							},
-							{
-								Key:   "/field/subfield2",
-								Value: "value2",
-							},
-							{
-								Key:   "/field/subfield3",
-								Value: "value3",
-							},
-						},
-					},
-				},
+			description: "it should stop the watch when sending a value to the stop channel",
+			watch: func(c *Client, cfg *config, called chan<- bool) func() {
+				stop, err := c.Watch(&cfg.Field, func() {
+					called <- true
+				})
+
+				if err != nil {
+					t.Fatalf("unexpected error. %s", err)
+				}
+
+				return func() {
+					stop <- false
+
+					// Watch doesn't wait for the teardown
+					time.Sleep(50 * time.Millisecond)
+				}
 			},
-			config: &struct {
-				Field map[string]string `etcd:"field"`
-			}{},
-			expected: struct {
-				Field map[string]string `etcd:"field"`
-			}{
-				Field: map[string]string{
-					"subfield1": "value1",
-					"subfield2": "value2",
-					"subfield3": "value3",
-				},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestWatchContext for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field", Value: "value1"},
+			},
+		}
+
+		var cfg config
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		called := make(chan bool, 1)
+		stop := item.watch(&c, &cfg, called)
+		stop()
+
+		// Nobody should be waiting for changes in etcd anymore
+		select {
+		case mock.change <- etcd.Node{Value: "value2"}:
+			t.Errorf("Item %d, “%s”: watch still running", i, item.description)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		select {
+		case <-called:
+			t.Errorf("Item %d, “%s”: callback called after stopping the watch", i, item.description)
+		default:
+		}
+	}
+
+	// The watch must fail for fields that weren't loaded
+	if _, err := new(Client).WatchContext(context.Background(), &struct{}{}, func() {}); err == nil {
+		t.Error("Error expected when watching an unknown field")
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	type config struct {
+		Field1 string `etcd:"field1"`
+		Field2 struct {
+			Subfield1 string            `etcd:"subfield1"`
+			Subfield2 map[string]string `etcd:"subfield2"`
+		} `etcd:"field2"`
+	}
+
+	var cfg config
+
+	data := []struct {
+		description string      // describe the test case
+		field       interface{} // field being watched
+		action      string      // etcd action of the change
+		path        string      // path that changed
+		value       string      // new value of the path
+		expected    Event       // expected event in the callback
+	}{
+		{
+			description: "it should report a change in the watched field",
+			field:       &cfg.Field1,
+			action:      "set",
+			path:        "/field1",
+			value:       "value2",
+			expected: Event{
+				Path:     "/field1",
+				Action:   "set",
+				OldValue: "value1",
+				NewValue: "value2",
+				Version:  101,
+				Field:    &cfg.Field1,
+				Paths:    []string{"/field1"},
 			},
 		},
 		{
-			description: "it should load a map of string to struct",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key: "/field/key1",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/key1/subfield1",
-										Value: "value1",
-									},
-									{
-										Key:   "/field/key1/subfield2",
-										Value: "10",
-									},
-								},
-							},
-							{
-								Key: "/field/key2",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/key2/subfield1",
-										Value: "value2",
-									},
-									{
-										Key:   "/field/key2/subfield2",
-										Value: "20",
-									},
-								},
+			description: "it should report the subfield that changed",
+			field:       &cfg.Field2,
+			action:      "set",
+			path:        "/field2/subfield1",
+			value:       "subvalue2",
+			expected: Event{
+				Path:     "/field2/subfield1",
+				Action:   "set",
+				OldValue: "subvalue1",
+				NewValue: "subvalue2",
+				Version:  101,
+				Field:    &cfg.Field2.Subfield1,
+				Paths:    []string{"/field2/subfield1"},
+			},
+		},
+		{
+			description: "it should report the map of a new entry",
+			field:       &cfg.Field2,
+			action:      "create",
+			path:        "/field2/subfield2/key2",
+			value:       "value2",
+			expected: Event{
+				Path:     "/field2/subfield2/key2",
+				Action:   "create",
+				NewValue: "value2",
+				Version:  101,
+				Field:    &cfg.Field2.Subfield2,
+				Paths:    []string{"/field2/subfield2/key2"},
+				Added:    []string{"key2"},
+			},
+		},
+		{
+			description: "it should report a removed entry",
+			field:       &cfg.Field2,
+			action:      "delete",
+			path:        "/field2/subfield2/key1",
+			expected: Event{
+				Path:     "/field2/subfield2/key1",
+				Action:   "delete",
+				OldValue: "value1",
+				Version:  101,
+				Field:    &cfg.Field2.Subfield2,
+				Paths:    []string{"/field2/subfield2/key1"},
+				Removed:  []string{"key1"},
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestWatchEvents for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field1", Value: "value1"},
+				{
+					Key: "/field2",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field2/subfield1", Value: "subvalue1"},
+						{
+							Key: "/field2/subfield2",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/field2/subfield2/key1", Value: "value1"},
 							},
 						},
 					},
 				},
 			},
-			config: &struct {
-				Field map[string]struct {
-					Subfield1 string `etcd:"subfield1"`
-					Subfield2 int    `etcd:"subfield2"`
-				} `etcd:"field"`
-			}{},
-			expected: struct {
-				Field map[string]struct {
-					Subfield1 string `etcd:"subfield1"`
-					Subfield2 int    `etcd:"subfield2"`
-				} `etcd:"field"`
-			}{
-				Field: map[string]struct {
-					Subfield1 string `etcd:"subfield1"`
-					Subfield2 int    `etcd:"subfield2"`
-				}{
-					"key1": struct {
-						Subfield1 string `etcd:"subfield1"`
-						Subfield2 int    `etcd:"subfield2"`
-					}{
-						Subfield1: "value1",
-						Subfield2: 10,
-					},
-					"key2": struct {
-						Subfield1 string `etcd:"subfield1"`
-						Subfield2 int    `etcd:"subfield2"`
-					}{
-						Subfield1: "value2",
-						Subfield2: 20,
-					},
-				},
+		}
+		mock.etcdIndex = 100
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		if err := c.Load(); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error loading. %s", i, item.description, err.Error())
+			continue
+		}
+
+		events := make(chan Event, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done, err := c.WatchEvents(ctx, item.field, func(event Event) {
+			events <- event
+		})
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			cancel()
+			continue
+		}
+
+		mock.notifyEvent(item.action, item.path, item.value)
+		event := <-events
+		cancel()
+		<-done
+
+		if !reflect.DeepEqual(event, item.expected) {
+			t.Errorf("Item %d, “%s”: event mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, event)
+		}
+	}
+}
+
+func TestWatchAll(t *testing.T) {
+	type config struct {
+		Field1 string `etcd:"field1"`
+		Field2 struct {
+			Subfield1 string            `etcd:"subfield1"`
+			Subfield2 map[string]string `etcd:"subfield2"`
+		} `etcd:"field2"`
+		Field3 []int `etcd:"field3"`
+	}
+
+	var cfg config
+
+	data := []struct {
+		description string // describe the test case
+		action      string // etcd action of the change
+		path        string // path that changed
+		value       string // new value of the path
+		expected    Event  // expected event in the callback
+	}{
+		{
+			description: "it should report a change in a field",
+			action:      "set",
+			path:        "/field1",
+			value:       "value2",
+			expected: Event{
+				Path:     "/field1",
+				Action:   "set",
+				OldValue: "value1",
+				NewValue: "value2",
+				Version:  102,
+				Field:    &cfg.Field1,
+				Paths:    []string{"/field1"},
 			},
 		},
 		{
-			description: "it should fail to load a non-pointer to structure",
-			config:      123,
-			expectedErr: true,
+			description: "it should report a change in a subfield",
+			action:      "set",
+			path:        "/field2/subfield1",
+			value:       "subvalue2",
+			expected: Event{
+				Path:     "/field2/subfield1",
+				Action:   "set",
+				OldValue: "subvalue1",
+				NewValue: "subvalue2",
+				Version:  102,
+				Field:    &cfg.Field2.Subfield1,
+				Paths:    []string{"/field2/subfield1"},
+			},
 		},
 		{
-			description: "it should fail when etcd rejects a get string",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should report the map of a new entry",
+			action:      "create",
+			path:        "/field2/subfield2/key2",
+			value:       "value2",
+			expected: Event{
+				Path:     "/field2/subfield2/key2",
+				Action:   "create",
+				NewValue: "value2",
+				Version:  102,
+				Field:    &cfg.Field2.Subfield2,
+				Paths:    []string{"/field2/subfield2/key2"},
+				Added:    []string{"key2"},
 			},
-			config: &struct {
-				Field string `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd rejects a get int",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should report the slice of a changed item",
+			action:      "set",
+			path:        "/field3/0",
+			value:       "20",
+			expected: Event{
+				Path:     "/field3/0",
+				Action:   "set",
+				OldValue: "10",
+				NewValue: "20",
+				Version:  102,
+				Field:    &cfg.Field3,
+				Paths:    []string{"/field3/0"},
+				Modified: []string{"0"},
 			},
-			config: &struct {
-				Field int `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
-		{
-			description: "it should fail when etcd rejects a get int64",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestWatchAll for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field1", Value: "value1"},
+				{
+					Key: "/field2",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field2/subfield1", Value: "subvalue1"},
+						{
+							Key: "/field2/subfield2",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/field2/subfield2/key1", Value: "value1"},
+							},
+						},
+					},
+				},
+				{
+					Key: "/field3",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field3/0", Value: "10"},
+					},
+				},
 			},
-			config: &struct {
-				Field int64 `etcd:"field"`
-			}{},
-			expectedErr: true,
+		}
+		mock.etcdIndex = 100
+
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		if err := c.Load(); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error loading. %s", i, item.description, err.Error())
+			continue
+		}
+
+		// Only the changed field must be loaded again
+		mock.getErrors["/"] = fmt.Errorf("namespace loaded again")
+
+		errs := make(chan error, 10)
+		events := make(chan Event, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done, err := c.WatchAll(ctx, func(event Event) {
+			events <- event
+		}, WithErrorHandler(func(err error) {
+			errs <- err
+		}))
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			cancel()
+			continue
+		}
+
+		// Keys that don't belong to the configuration must be ignored
+		mock.notifyEvent("set", "/unknown", "value")
+
+		mock.notifyEvent(item.action, item.path, item.value)
+		event := <-events
+		cancel()
+		<-done
+
+		if !reflect.DeepEqual(event, item.expected) {
+			t.Errorf("Item %d, “%s”: event mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, event)
+		}
+
+		if len(errs) > 0 {
+			t.Errorf("Item %d, “%s”: unexpected watch error. %s", i, item.description, <-errs)
+		}
+
+		var expected config
+		expected.Field1 = "value1"
+		expected.Field2.Subfield1 = "subvalue1"
+		expected.Field2.Subfield2 = map[string]string{"key1": "value1"}
+		expected.Field3 = []int{10}
+
+		switch item.path {
+		case "/field1":
+			expected.Field1 = item.value
+		case "/field2/subfield1":
+			expected.Field2.Subfield1 = item.value
+		case "/field2/subfield2/key2":
+			expected.Field2.Subfield2["key2"] = item.value
+		case "/field3/0":
+			expected.Field3 = []int{20}
+		}
+
+		var current config
+		c.Read(func() {
+			current = cfg
+		})
+
+		if !reflect.DeepEqual(current, expected) {
+			t.Errorf("Item %d, “%s”: configuration mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, expected, current)
+		}
+	}
+}
+
+func TestWatchAllStart(t *testing.T) {
+	type config struct {
+		Field1 string `etcd:"field1"`
+		Field2 string `etcd:"field2"`
+	}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1", ModifiedIndex: 1},
+			{Key: "/field2", Value: "value1", ModifiedIndex: 2},
 		},
-		{
-			description: "it should fail when etcd returns a number with an invalid format",
-			etcdData: etcd.Node{
+	}
+	mock.etcdIndex = 2
+
+	var cfg config
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
+
+	// The first field changes after it was read, and the second field is read after its own change,
+	// as it happens when the fields are loaded by different requests
+	if _, err := mock.Set("/field1", "value2", 0); err != nil {
+		t.Fatalf("Unexpected error changing the value. %s", err)
+	}
+
+	if _, err := mock.Set("/field2", "value2", 0); err != nil {
+		t.Fatalf("Unexpected error changing the value. %s", err)
+	}
+
+	if err := c.LoadField(&cfg.Field2); err != nil {
+		t.Fatalf("Unexpected error loading the field. %s", err)
+	}
+
+	events := make(chan Event, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done, err := c.WatchAll(ctx, func(event Event) {
+		events <- event
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the configuration. %s", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Path != "/field1" || event.NewValue != "value2" {
+			t.Errorf("Change of the first field expected. Found “%+v”", event)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("Change made before the last load was lost")
+	}
+
+	cancel()
+	<-done
+
+	var field1 string
+	c.Read(func() {
+		field1 = cfg.Field1
+	})
+
+	if field1 != "value2" {
+		t.Errorf("Field not updated. Expecting “value2”; found “%s”", field1)
+	}
+}
+
+func TestWatchDebounce(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 map[string]string `etcd:"field2"`
+	}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1"},
+			{
+				Key: "/field2",
 				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key:   "/field",
-						Value: "NaN",
-					},
+					{Key: "/field2/key1", Value: "value1"},
 				},
 			},
-			config: &struct {
-				Field int `etcd:"field"`
-			}{},
-			expectedErr: true,
-		},
-		{
-			description: "it should fail when etcd rejects a get bool",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
-			},
-			config: &struct {
-				Field bool `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
+	}
+	mock.etcdIndex = 100
+
+	var cfg config
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
+
+	events := make(chan Event, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done, err := c.WatchAll(ctx, func(event Event) {
+		events <- event
+	}, WithDebounce(50*time.Millisecond))
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the configuration. %s", err)
+	}
+
+	// A burst of changes in different fields must be reported once
+	mock.notifyEvent("set", "/field2/key2", "value2")
+	mock.notifyEvent("set", "/field1", "value2")
+	mock.notifyEvent("set", "/field2/key1", "value3")
+	mock.notifyEvent("set", "/field1", "value3")
+
+	expected := Event{
+		Path:     "/field1",
+		Action:   "set",
+		OldValue: "value2",
+		NewValue: "value3",
+		Version:  104,
+		Field:    &cfg,
+		Paths:    []string{"/field1", "/field2/key1", "/field2/key2"},
+	}
+
+	if event := <-events; !reflect.DeepEqual(event, expected) {
+		t.Errorf("Event mismatch. Expecting “%+v”; found “%+v”", expected, event)
+	}
+
+	var field1 string
+	var field2 map[string]string
+	c.Read(func() {
+		field1, field2 = cfg.Field1, cfg.Field2
+	})
+
+	if field1 != "value3" {
+		t.Errorf("Field1 mismatch. Expecting “value3”; found “%s”", field1)
+	}
+
+	if expected := map[string]string{"key1": "value3", "key2": "value2"}; !reflect.DeepEqual(field2, expected) {
+		t.Errorf("Field2 mismatch. Expecting “%v”; found “%v”", expected, field2)
+	}
+
+	// When all changes are from the same field the event refers to it
+	mock.notifyEvent("delete", "/field2/key2", "")
+	mock.notifyEvent("set", "/field2/key3", "value4")
+
+	expected = Event{
+		Path:     "/field2/key3",
+		Action:   "set",
+		NewValue: "value4",
+		Version:  106,
+		Field:    &cfg.Field2,
+		Paths:    []string{"/field2/key2", "/field2/key3"},
+		Added:    []string{"key3"},
+		Removed:  []string{"key2"},
+	}
+
+	if event := <-events; !reflect.DeepEqual(event, expected) {
+		t.Errorf("Event mismatch. Expecting “%+v”; found “%+v”", expected, event)
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected event “%+v”", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	<-done
+
+	// When a field of the burst cannot be applied, none of them is applied
+	rejection := fmt.Errorf("entry rejected")
+	errs := make(chan error, 10)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	done, err = c.WatchAll(ctx, func(event Event) {
+		events <- event
+	}, WithDebounce(50*time.Millisecond), WithErrorHandler(func(err error) {
+		errs <- err
+	}), WithApproval(func(path string, proposed interface{}) error {
+		if path == "/field2" {
+			return rejection
+		}
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the configuration. %s", err)
+	}
+
+	mock.notifyEvent("set", "/field1", "value5")
+	mock.notifyEvent("set", "/field2/key4", "value5")
+
+	if err := <-errs; !errors.Is(err, rejection) {
+		t.Errorf("Rejection expected. Found “%v”", err)
+	}
+
+	c.Read(func() {
+		field1, field2 = cfg.Field1, cfg.Field2
+	})
+
+	if field1 != "value3" {
+		t.Errorf("Field1 partially updated. Expecting “value3”; found “%s”", field1)
+	}
+
+	if expected := map[string]string{"key1": "value3", "key3": "value4"}; !reflect.DeepEqual(field2, expected) {
+		t.Errorf("Field2 mismatch. Expecting “%v”; found “%v”", expected, field2)
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected event “%+v”", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	<-done
+}
+
+func TestSubscribe(t *testing.T) {
+	type config struct {
+		Field map[string]string `etcd:"field"`
+	}
+
+	var cfg config
+
+	data := []struct {
+		description string         // describe the test case
+		buffer      int            // size of the subscription channel
+		overflow    OverflowPolicy // what to do when the channel is full
+		expected    []Event        // expected events in the channel
+	}{
 		{
-			description: "it should fail when etcd rejects to get a structure field",
-			init: func(c *clientMock) {
-				c.getErrors["/field/subfield"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should coalesce the events of a slow consumer",
+			buffer:      1,
+			overflow:    OverflowCoalesce,
+			expected: []Event{
+				{
+					Path:     "/field/key3",
+					Action:   "set",
+					NewValue: "value3",
+					Version:  103,
+					Field:    &cfg.Field,
+					Paths:    []string{"/field/key1", "/field/key2", "/field/key3"},
+					Added:    []string{"key1", "key2", "key3"},
+				},
 			},
-			config: &struct {
-				Field struct {
-					Subfield int `etcd:"subfield"`
-				} `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd rejects to get a slice of structure",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should drop the oldest events of a slow consumer",
+			buffer:      2,
+			overflow:    OverflowDropOldest,
+			expected: []Event{
+				{
+					Path:     "/field/key2",
+					Action:   "set",
+					NewValue: "value2",
+					Version:  102,
+					Field:    &cfg.Field,
+					Paths:    []string{"/field/key2"},
+				},
+				{
+					Path:     "/field/key3",
+					Action:   "set",
+					NewValue: "value3",
+					Version:  103,
+					Field:    &cfg.Field,
+					Paths:    []string{"/field/key3"},
+				},
 			},
-			config: &struct {
-				Field []struct {
-					Subfield int `etcd:"subfield"`
-				} `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd returns corrupted data in a structure of a slice",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key: "/field/0",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/0/subfield",
-										Value: "NaN",
-									},
-								},
-							},
-						},
-					},
+			description: "it should block until the consumer reads the events",
+			buffer:      0,
+			overflow:    OverflowBlock,
+			expected: []Event{
+				{
+					Path:     "/field/key1",
+					Action:   "set",
+					NewValue: "value1",
+					Version:  101,
+					Field:    &cfg.Field,
+					Paths:    []string{"/field/key1"},
+				},
+				{
+					Path:     "/field/key2",
+					Action:   "set",
+					NewValue: "value2",
+					Version:  102,
+					Field:    &cfg.Field,
+					Paths:    []string{"/field/key2"},
+				},
+				{
+					Path:     "/field/key3",
+					Action:   "set",
+					NewValue: "value3",
+					Version:  103,
+					Field:    &cfg.Field,
+					Paths:    []string{"/field/key3"},
 				},
 			},
-			config: &struct {
-				Field []struct {
-					Subfield int `etcd:"subfield"`
-				} `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
-		{
-			description: "it should fail when etcd rejects to get the slice of strings",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSubscribe for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field", Dir: true},
+			},
+		}
+		mock.etcdIndex = 100
+
+		cfg = config{}
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(&cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		events, unsubscribe, err := c.Subscribe(&cfg.Field, WithBuffer(item.buffer, item.overflow))
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		// The changes are only read after all of them were sent (except when blocking)
+		notified := make(chan bool)
+		go func() {
+			mock.notifyEvent("set", "/field/key1", "value1")
+			mock.notifyEvent("set", "/field/key2", "value2")
+			mock.notifyEvent("set", "/field/key3", "value3")
+			close(notified)
+		}()
+
+		if item.overflow != OverflowBlock {
+			<-notified
+
+			// the last change could still be on the way to the channel
+			for c.versions("/field")["/field/key3"] == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		var received []Event
+		for range item.expected {
+			event := <-events
+
+			// Without coalescing, the entries depend on the moment that each change was loaded
+			if item.overflow != OverflowCoalesce {
+				event.Added, event.Removed, event.Modified = nil, nil, nil
+			}
+
+			received = append(received, event)
+		}
+
+		unsubscribe()
+		unsubscribe()
+
+		if event, ok := <-events; ok {
+			t.Errorf("Item %d, “%s”: unexpected event “%+v”", i, item.description, event)
+		}
+
+		if !reflect.DeepEqual(received, item.expected) {
+			t.Errorf("Item %d, “%s”: events mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, received)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	var cfg struct {
+		Field1 map[string]string
+		Field2 []string
+	}
+
+	data := []struct {
+		description string  // describe the test case
+		events      []Event // events waiting in the channel
+		expected    Event   // expected merged event
+	}{
+		{
+			description: "it should merge the entries of the same field",
+			events: []Event{
+				{Path: "/field1/a", Field: &cfg.Field1, Paths: []string{"/field1/a"}, Added: []string{"a"}},
+				{Path: "/field1/b", Field: &cfg.Field1, Paths: []string{"/field1/b"}, Removed: []string{"b"}},
+				{Path: "/field1/a", Field: &cfg.Field1, Paths: []string{"/field1/a"}, Modified: []string{"a"}},
+				{Path: "/field1/b", Field: &cfg.Field1, Paths: []string{"/field1/b"}, Added: []string{"b"}},
+				{Path: "/field1/c", Field: &cfg.Field1, Paths: []string{"/field1/c"}, Removed: []string{"c"}},
+			},
+			expected: Event{
+				Path:     "/field1/c",
+				Field:    &cfg.Field1,
+				Paths:    []string{"/field1/a", "/field1/b", "/field1/c"},
+				Added:    []string{"a"},
+				Removed:  []string{"c"},
+				Modified: []string{"b"},
 			},
-			config: &struct {
-				Field []string `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd rejects to get the slice of int",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should discard entries added and removed",
+			events: []Event{
+				{Path: "/field2/10", Field: &cfg.Field2, Paths: []string{"/field2/10"}, Added: []string{"2", "10"}},
+				{Path: "/field2/10", Field: &cfg.Field2, Paths: []string{"/field2/10"}, Removed: []string{"10"}},
+			},
+			expected: Event{
+				Path:  "/field2/10",
+				Field: &cfg.Field2,
+				Paths: []string{"/field2/10"},
+				Added: []string{"2"},
 			},
-			config: &struct {
-				Field []int `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd returns an invalid int in a slice",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/0",
-								Value: "NaN",
-							},
-						},
-					},
-				},
+			description: "it should not merge the entries of different fields",
+			events: []Event{
+				{Path: "/field1/a", Field: &cfg.Field1, Paths: []string{"/field1/a"}, Added: []string{"a"}},
+				{Path: "/field2/0", Field: &cfg.Field2, Paths: []string{"/field2/0"}, Added: []string{"0"}},
+			},
+			expected: Event{
+				Path:  "/field2/0",
+				Field: &cfg,
+				Paths: []string{"/field1/a", "/field2/0"},
 			},
-			config: &struct {
-				Field []int `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
+	}
+
+	for i, item := range data {
+		if event := coalesce(item.events, &cfg); !reflect.DeepEqual(event, item.expected) {
+			t.Errorf("Item %d, “%s”: event mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, event)
+		}
+	}
+}
+
+func TestWatchDelete(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1" default:"value0"`
+		Field2 int               `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+		Field5 struct {
+			Subfield1 bool   `etcd:"subfield1" default:"true"`
+			Subfield2 string `etcd:"subfield2"`
+		} `etcd:"field5"`
+		Field6 Value[time.Duration] `etcd:"field6" default:"1m"`
+	}
+
+	data := []struct {
+		description string             // describe the test case
+		action      string             // etcd action of the removal
+		path        string             // path that was removed
+		expected    Event              // expected event in the callback
+		check       func(*config) bool // check the field after the removal
+	}{
 		{
-			description: "it should fail when etcd rejects to get the slice of int64",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should use the default value of a deleted field",
+			action:      "delete",
+			path:        "/field1",
+			expected: Event{
+				Path:     "/field1",
+				Action:   "delete",
+				OldValue: "value1",
+				Version:  101,
+				Paths:    []string{"/field1"},
+			},
+			check: func(cfg *config) bool {
+				return cfg.Field1 == "value0"
 			},
-			config: &struct {
-				Field []int64 `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd returns an invalid int64 in a slice",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/field/0",
-								Value: "NaN",
-							},
-						},
-					},
-				},
+			description: "it should use the zero value of an expired field without default",
+			action:      "expire",
+			path:        "/field2",
+			expected: Event{
+				Path:     "/field2",
+				Action:   "expire",
+				OldValue: "10",
+				Version:  101,
+				Paths:    []string{"/field2"},
+			},
+			check: func(cfg *config) bool {
+				return cfg.Field2 == 0
 			},
-			config: &struct {
-				Field []int64 `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd rejects to get the slice of bool",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should remove a deleted map entry",
+			action:      "delete",
+			path:        "/field3/key1",
+			expected: Event{
+				Path:     "/field3/key1",
+				Action:   "delete",
+				OldValue: "value1",
+				Version:  101,
+				Paths:    []string{"/field3/key1"},
+				Removed:  []string{"key1"},
+			},
+			check: func(cfg *config) bool {
+				return reflect.DeepEqual(cfg.Field3, map[string]string{"key2": "value2"})
 			},
-			config: &struct {
-				Field []bool `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd rejects to get a map",
-			init: func(c *clientMock) {
-				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+			description: "it should empty a deleted map",
+			action:      "delete",
+			path:        "/field3",
+			expected: Event{
+				Path:    "/field3",
+				Action:  "delete",
+				Version: 101,
+				Paths:   []string{"/field3"},
+				Removed: []string{"key1", "key2"},
+			},
+			check: func(cfg *config) bool {
+				// the map must still be writable
+				return cfg.Field3 != nil && len(cfg.Field3) == 0
 			},
-			config: &struct {
-				Field map[string]string `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd returns a corrupted data for a struct in a map",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key: "/field/key1",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/key1/subfield1",
-										Value: "value1",
-									},
-									{
-										Key:   "/field/key1/subfield2",
-										Value: "NaN",
-									},
-								},
-							},
-						},
-					},
-				},
+			description: "it should shrink a slice with an expired item",
+			action:      "expire",
+			path:        "/field4/1",
+			expected: Event{
+				Path:     "/field4/1",
+				Action:   "expire",
+				OldValue: "value2",
+				Version:  101,
+				Paths:    []string{"/field4/1"},
+				Removed:  []string{"1"},
+			},
+			check: func(cfg *config) bool {
+				return reflect.DeepEqual(cfg.Field4, []string{"value1"})
 			},
-			config: &struct {
-				Field map[string]struct {
-					Subfield1 string `etcd:"subfield1"`
-					Subfield2 int    `etcd:"subfield2"`
-				} `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd data is corrupted",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key: "/field/subfield",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/subfield/subsubfield2",
-										Value: "NaN",
-									},
-								},
-							},
-						},
-					},
-				},
+			description: "it should use the default values of a deleted structure",
+			action:      "delete",
+			path:        "/field5",
+			expected: Event{
+				Path:    "/field5",
+				Action:  "delete",
+				Version: 101,
+				Paths:   []string{"/field5"},
+			},
+			check: func(cfg *config) bool {
+				return cfg.Field5.Subfield1 && cfg.Field5.Subfield2 == ""
 			},
-			config: &struct {
-				Field struct {
-					Subfield struct {
-						Subsubfield1 string
-						Subsubfield2 int `etcd:"subsubfield2"`
-					} `etcd:"subfield"`
-				} `etcd:"field"`
-			}{},
-			expectedErr: true,
 		},
 		{
-			description: "it should load correctly when using namespaces",
-			etcdData: etcd.Node{
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key: "/test",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key:   "/test/field1",
-								Value: "value1",
-							},
-							{
-								Key:   "/test/field2",
-								Value: "10",
-							},
-							{
-								Key:   "/test/field3",
-								Value: "20",
-							},
-							{
-								Key:   "/test/field4",
-								Value: "true",
-							},
-						},
+			description: "it should use the default value of a deleted Value field",
+			action:      "delete",
+			path:        "/field6",
+			expected: Event{
+				Path:     "/field6",
+				Action:   "delete",
+				OldValue: "30s",
+				Version:  101,
+				Paths:    []string{"/field6"},
+			},
+			check: func(cfg *config) bool {
+				return cfg.Field6.Get() == time.Minute
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestWatchDelete for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &etcd.Node{
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/field1", Value: "value1"},
+				{Key: "/field2", Value: "10"},
+				{
+					Key: "/field3",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field3/key1", Value: "value1"},
+						{Key: "/field3/key2", Value: "value2"},
 					},
 				},
+				{
+					Key: "/field4",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field4/0", Value: "value1"},
+						{Key: "/field4/1", Value: "value2"},
+					},
+				},
+				{
+					Key: "/field5",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/field5/subfield1", Value: "false"},
+						{Key: "/field5/subfield2", Value: "value1"},
+					},
+				},
+				{Key: "/field6", Value: "30s"},
 			},
-			namespace: "test",
-			config: &struct {
-				Field1 string `etcd:"field1"`
-				Field2 int    `etcd:"field2"`
-				Field3 int64  `etcd:"field3"`
-				Field4 bool   `etcd:"field4"`
-			}{},
-			expected: struct {
-				Field1 string `etcd:"field1"`
-				Field2 int    `etcd:"field2"`
-				Field3 int64  `etcd:"field3"`
-				Field4 bool   `etcd:"field4"`
-			}{
-				Field1: "value1",
-				Field2: 10,
-				Field3: 20,
-				Field4: true,
-			},
+		}
+		mock.etcdIndex = 100
+
+		cfg := new(config)
+		c := Client{
+			etcdClient: mock,
+			config:     reflect.ValueOf(cfg),
+			info:       make(map[string]info),
+		}
+
+		c.preload(c.config, "")
+
+		if err := c.Load(); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error loading. %s", i, item.description, err.Error())
+			continue
+		}
+
+		errs := make(chan error, 10)
+		events := make(chan Event, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done, err := c.WatchAll(ctx, func(event Event) {
+			events <- event
+		}, WithErrorHandler(func(err error) {
+			errs <- err
+		}))
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			cancel()
+			continue
+		}
+
+		mock.notifyEvent(item.action, item.path, "")
+		event := <-events
+		cancel()
+		<-done
+
+		// the configuration is created for each item, so the field pointer is not compared
+		event.Field = nil
+
+		if !reflect.DeepEqual(event, item.expected) {
+			t.Errorf("Item %d, “%s”: event mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, event)
+		}
+
+		if len(errs) > 0 {
+			t.Errorf("Item %d, “%s”: unexpected watch error. %s", i, item.description, <-errs)
+		}
+
+		var ok bool
+		c.Read(func() {
+			ok = item.check(cfg)
+		})
+
+		if !ok {
+			t.Errorf("Item %d, “%s”: field not reset after the removal", i, item.description)
+		}
+	}
+}
+
+func TestWatchApproval(t *testing.T) {
+	type config struct {
+		PoolSize int `etcd:"poolsize" default:"1"`
+	}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/poolsize", Value: "2"},
+		},
+	}
+	mock.etcdIndex = 100
+
+	var cfg config
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
+
+	rejection := fmt.Errorf("pool size too big")
+	var proposals []string
+
+	errs := make(chan error, 10)
+	events := make(chan Event, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done, err := c.WatchEvents(ctx, &cfg.PoolSize, func(event Event) {
+		events <- event
+	}, WithErrorHandler(func(err error) {
+		errs <- err
+	}), WithApproval(func(path string, proposed interface{}) error {
+		poolSize := *proposed.(*int)
+		proposals = append(proposals, fmt.Sprintf("%s=%d", path, poolSize))
+
+		if poolSize > 10 {
+			return rejection
+		}
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+
+	poolSize := func() (value int) {
+		c.Read(func() {
+			value = cfg.PoolSize
+		})
+		return
+	}
+
+	mock.notifyEvent("set", "/poolsize", "5")
+
+	if event := <-events; event.NewValue != "5" || poolSize() != 5 {
+		t.Errorf("Approved value not applied. Found event “%+v” and pool size %d", event, poolSize())
+	}
+
+	// A rejected value must be reported, keeping the previous value
+	mock.notifyEvent("set", "/poolsize", "50")
+
+	var rejected *RejectedError
+	if err := <-errs; !errors.As(err, &rejected) || !errors.Is(err, rejection) ||
+		err.(*FieldError).Path != "/poolsize" {
+
+		t.Errorf("Unexpected rejection error. Found “%v”", err)
+	}
+
+	if poolSize() != 5 {
+		t.Errorf("Rejected value applied. Expecting pool size 5; found %d", poolSize())
+	}
+
+	// Removed keys must also be approved
+	mock.notifyEvent("delete", "/poolsize", "")
+
+	if event := <-events; event.Action != "delete" || poolSize() != 1 {
+		t.Errorf("Approved removal not applied. Found event “%+v” and pool size %d", event, poolSize())
+	}
+
+	cancel()
+	<-done
+
+	if len(events) > 0 {
+		t.Errorf("Unexpected event “%+v”", <-events)
+	}
+
+	expected := []string{"/poolsize=5", "/poolsize=50", "/poolsize=1"}
+	if !reflect.DeepEqual(proposals, expected) {
+		t.Errorf("Proposals mismatch. Expecting “%v”; found “%v”", expected, proposals)
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	type config struct {
+		Field1 string `etcd:"field1"`
+		Field2 int    `etcd:"field2"`
+	}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1", ModifiedIndex: 1},
+			{Key: "/field2", Value: "10", ModifiedIndex: 2},
 		},
 	}
 
-	for i, item := range data {
-		if DEBUG {
-			fmt.Printf(">>> Running TestLoad for index %d\n", i)
-		}
+	mock.etcdIndex = 2
 
-		mock := NewClientMock()
-		mock.root = &item.etcdData
+	var cfg config
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
 
-		c := Client{
-			etcdClient: mock,
-			namespace:  item.namespace,
-			config:     reflect.ValueOf(item.config),
-			info:       make(map[string]info),
-		}
+	c.preload(c.config, "")
 
-		if item.init != nil {
-			item.init(mock)
-		}
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
 
-		err := c.Load()
-		if err == nil && item.expectedErr {
-			t.Errorf("Item %d, “%s”: error expected", i, item.description)
-			continue
+	watchErr := fmt.Errorf("cluster unavailable")
+	mock.watchErrors["/field1"] = watchErr
 
-		} else if err != nil && !item.expectedErr {
-			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
-			continue
-		}
+	errs := make(chan error, 100)
+	events := make(chan Event, 10)
 
-		if !item.expectedErr && reflect.DeepEqual(item.config, item.expected) {
-			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
-				i, item.description, item.expected, item.config)
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	options := []WatchOption{
+		WithErrorHandler(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}),
+		WithBackoff(time.Millisecond, 5*time.Millisecond),
+	}
+
+	done, err := c.WatchEvents(ctx, &cfg.Field1, func(event Event) {
+		events <- event
+	}, options...)
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+
+	// The watch error must be reported
+	if err := <-errs; err.(*FieldError).Path != "/field1" || err.(*FieldError).Err != watchErr {
+		t.Errorf("Unexpected watch error. Found “%v”", err)
+	}
+
+	// The value changed while the watch was down, so the watch must be resumed from the last index
+	if _, err := mock.Set("/field1", "value2", 0); err != nil {
+		t.Fatalf("Unexpected error changing the value. %s", err)
+	}
+
+	mock.Lock()
+	delete(mock.watchErrors, "/field1")
+	mock.Unlock()
+
+	if event := <-events; event.Action != "update" || event.NewValue != "value2" {
+		t.Errorf("Update event expected. Found “%+v”", event)
+	}
+
+	var field1 string
+	c.Read(func() {
+		field1 = cfg.Field1
+	})
+
+	if field1 != "value2" {
+		t.Errorf("Field not reloaded. Expecting “value2”; found “%s”", field1)
+	}
+
+	// After reconnecting the changes must be received again
+	mock.notifyEvent("set", "/field1", "value3")
+
+	if event := <-events; event.Action != "set" || event.NewValue != "value3" {
+		t.Errorf("Set event expected. Found “%+v”", event)
+	}
+
+	cancel()
+	<-done
+
+	// When etcd doesn't have the changes after the version anymore the field must be reloaded
+	if _, err := mock.Set("/field1", "value4", 0); err != nil {
+		t.Fatalf("Unexpected error changing the value. %s", err)
+	}
+
+	mock.Lock()
+	mock.clearedIndex = mock.etcdIndex + 1
+	mock.Unlock()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	for len(errs) > 0 {
+		<-errs
+	}
+
+	// The reload is immediate, so a long backoff must not delay it
+	done, err = c.WatchEvents(ctx, &cfg.Field1, func(event Event) {
+		events <- event
+	}, append(options, WithBackoff(time.Minute, time.Minute))...)
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+
+	if event := <-events; event.Action != EventReload || event.Path != "/field1" || event.Version != 5 ||
+		!reflect.DeepEqual(event.Paths, []string{"/field1"}) {
+
+		t.Errorf("Reload event expected. Found “%+v”", event)
+	}
+
+	c.Read(func() {
+		field1 = cfg.Field1
+	})
+
+	if field1 != "value4" {
+		t.Errorf("Field not reloaded. Expecting “value4”; found “%s”", field1)
+	}
+
+	if len(errs) > 0 {
+		t.Errorf("Index cleared error should not be reported. Found “%v”", <-errs)
+	}
+
+	mock.Lock()
+	mock.clearedIndex = 0
+	mock.Unlock()
+
+	mock.notifyEvent("set", "/field1", "value5")
+
+	if event := <-events; event.Action != "set" || event.NewValue != "value5" {
+		t.Errorf("Set event expected. Found “%+v”", event)
+	}
+
+	// Values that cannot be loaded must be reported without calling the callback
+	cancel()
+	<-done
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	for len(errs) > 0 {
+		<-errs
+	}
+
+	done, err = c.WatchEvents(ctx, &cfg.Field2, func(event Event) {
+		events <- event
+	}, options...)
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+
+	mock.notifyEvent("set", "/field2", "abc")
+
+	if fieldErr, ok := (<-errs).(*FieldError); !ok || fieldErr.Path != "/field2" || fieldErr.Value != "abc" {
+		t.Errorf("Unexpected load error. Found “%v”", fieldErr)
+	}
+
+	cancel()
+	<-done
+
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected event “%+v”", event)
+	default:
 	}
 }
 
-func BenchmarkLoad(b *testing.B) {
+func BenchmarkWatch(b *testing.B) {
 	mock := NewClientMock()
 	mock.root = &etcd.Node{
 		Dir: true,
@@ -2395,415 +6130,488 @@ func BenchmarkLoad(b *testing.B) {
 		},
 	}
 
+	s := struct {
+		Field string `etcd:"field"`
+	}{}
+
 	c := Client{
 		etcdClient: mock,
-		config: reflect.ValueOf(&struct {
-			Field string `etcd:"field"`
-		}{}),
-		info: make(map[string]info),
+		config:     reflect.ValueOf(&s),
+		info:       make(map[string]info),
 	}
 
+	c.preload(c.config, "")
+
+	called := make(chan bool)
 	for i := 0; i < b.N; i++ {
-		if err := c.Load(); err != nil {
+		stop, err := c.Watch(&s.Field, func() {
+			called <- true
+		})
+
+		if err != nil {
 			b.Fatal(err)
 		}
+
+		mock.notifyChange(etcd.Node{
+			Value: "abc",
+		})
+
+		select {
+		case <-called:
+			close(stop)
+		}
 	}
 }
 
-func TestWatch(t *testing.T) {
-	config := struct {
-		Field1  string            `etcd:"field1"`
-		Field2  int               `etcd:"field2"`
-		Field3  int64             `etcd:"field3"`
-		Field4  bool              `etcd:"field4"`
-		Field5  map[string]string `etcd:"field5"`
-		Field6  []string          `etcd:"field6"`
-		Field7  []int             `etcd:"field7"`
-		Field8  []int64           `etcd:"field8"`
-		Field9  []bool            `etcd:"field9"`
-		Field10 struct {
-			Subfield1 string `etcd:"subfield1"`
-			Subfield2 int    `etcd:"subfield2"`
-			Subfield3 int64  `etcd:"subfield3"`
-			Subfield4 bool   `etcd:"subfield4"`
-		} `etcd:"field10"`
-	}{}
+func TestRead(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 map[string]string `etcd:"field2"`
+	}
 
-	etcdData := etcd.Node{
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
 		Dir: true,
 		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1"},
 			{
-				Key:   "/field1",
-				Value: "value1",
-			},
-			{
-				Key:   "/field2",
-				Value: "10",
-			},
-			{
-				Key:   "/field3",
-				Value: "20",
-			},
-			{
-				Key:   "/field4",
-				Value: "true",
-			},
-			{
-				Key: "/field5",
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field5/subfield1",
-						Value: "subvalue1",
-					},
-				},
-			},
-			{
-				Key: "/field6",
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field6/0",
-						Value: "subvalue1",
-					},
-					{
-						Key:   "/field6/1",
-						Value: "subvalue2",
-					},
-				},
-			},
-			{
-				Key: "/field7",
-				Dir: true,
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field7/0",
-						Value: "100",
-					},
-					{
-						Key:   "/field7/1",
-						Value: "200",
-					},
-				},
-			},
-			{
-				Key: "/field8",
+				Key: "/field2",
 				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key:   "/field8/0",
-						Value: "1000",
-					},
-					{
-						Key:   "/field8/1",
-						Value: "2000",
-					},
+					{Key: "/field2/key1", Value: "value1"},
 				},
 			},
+		},
+	}
+
+	var cfg config
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
+
+	done := make(chan bool)
+	stop, err := c.Watch(&cfg.Field2, func() {
+		done <- true
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+	defer close(stop)
+
+	var wg sync.WaitGroup
+	finish := make(chan bool)
+
+	// The readers run while the watch replaces the map (the race detector checks the access)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-finish:
+					return
+				default:
+				}
+
+				c.Read(func() {
+					for key, value := range cfg.Field2 {
+						if len(key) == 0 || len(value) == 0 {
+							t.Errorf("Unexpected empty entry in the map")
+						}
+					}
+				})
+			}
+		}()
+	}
+
+	mock.notifyChange(etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field2/key1", Value: "value1 modified"},
+			{Key: "/field2/key2", Value: "value2"},
+		},
+	})
+	<-done
+
+	close(finish)
+	wg.Wait()
+
+	var field2 map[string]string
+	c.Read(func() {
+		field2 = cfg.Field2
+	})
+
+	expected := map[string]string{"key1": "value1 modified", "key2": "value2"}
+	if !reflect.DeepEqual(field2, expected) {
+		t.Errorf("Field mismatch. Expecting “%v”; found “%v”", expected, field2)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 string            `etcd:"field2"`
+		Field3 map[string]string `etcd:"field3"`
+		Field4 []string          `etcd:"field4"`
+	}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1"},
+			{Key: "/field2", Value: "value2"},
 			{
-				Key: "/field9",
+				Key: "/field3",
 				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key:   "/field9/0",
-						Value: "true",
-					},
-					{
-						Key:   "/field9/1",
-						Value: "false",
-					},
+					{Key: "/field3/key1", Value: "value1"},
 				},
 			},
 			{
-				Key: "/field10",
+				Key: "/field4",
 				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key:   "/field10/subfield1",
-						Value: "subvalue1",
-					},
-					{
-						Key:   "/field10/subfield2",
-						Value: "500",
-					},
-					{
-						Key:   "/field10/subfield3",
-						Value: "800",
-					},
-					{
-						Key:   "/field10/subfield4",
-						Value: "true",
-					},
+					{Key: "/field4/0", Value: "value1"},
 				},
 			},
 		},
 	}
 
-	data := []struct {
-		description string            // describe the test case
-		init        func(*clientMock) // initial configuration of the mocked client (if necessary)
-		field       interface{}       // field that will be monitored for changes
-		changeValue etcd.Node         // value injected in the change
-		expectedErr bool              // error expectation when watching the configuration
-		expected    interface{}       // value expected in the field after the callback is called
-	}{
-		{
-			description: "it should watch a string field",
-			field:       &config.Field1,
-			changeValue: etcd.Node{
-				Value: "value1 modified",
-			},
-			expected: "value1 modified",
-		},
-		{
-			description: "it should watch an int field",
-			field:       &config.Field2,
-			changeValue: etcd.Node{
-				Value: "13",
-			},
-			expected: int(13),
-		},
-		{
-			description: "it should watch an int64 field",
-			field:       &config.Field3,
-			changeValue: etcd.Node{
-				Value: "27",
-			},
-			expected: int64(27),
+	var cfg config
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(&cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
+	c.SetConcurrency(4)
+
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
+
+	// Each change is received by one of the watches
+	fields := []interface{}{&cfg.Field1, &cfg.Field2, &cfg.Field3}
+	done := make(chan bool, len(fields))
+
+	for _, field := range fields {
+		stop, err := c.Watch(field, func() {
+			done <- true
+		})
+
+		if err != nil {
+			t.Fatalf("Unexpected error watching a field. %s", err)
+		}
+		defer close(stop)
+	}
+
+	var wg sync.WaitGroup
+	operations := []func() error{
+		func() error {
+			return c.Load()
 		},
-		{
-			description: "it should watch a bool field",
-			field:       &config.Field4,
-			changeValue: etcd.Node{
-				Value: "false",
-			},
-			expected: false,
+		func() error {
+			_, err := c.Save()
+			return err
 		},
-		{
-			description: "it should watch a map field",
-			field:       &config.Field5,
-			changeValue: etcd.Node{
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field5/subfield2",
-						Value: "subvalue2 modified",
-					},
-					{
-						Key:   "/field5/subfield3",
-						Value: "subvalue3 modified",
-					},
-				},
-			},
-			expected: map[string]string{
-				"subfield2": "subvalue2 modified",
-				"subfield3": "subvalue3 modified",
-			},
+		func() error {
+			_, err := c.Version(&cfg.Field1)
+			return err
 		},
-		{
-			description: "it should watch a slice of strings",
-			field:       &config.Field6,
-			changeValue: etcd.Node{
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field6/0",
-						Value: "subvalue1 modified",
-					},
-					{
-						Key:   "/field6/1",
-						Value: "subvalue2 modified",
-					},
-				},
-			},
-			expected: []string{
-				"subvalue1 modified",
-				"subvalue2 modified",
-			},
+		func() error {
+			_, err := c.MapEntryVersion(&cfg.Field3, "key1")
+			return err
 		},
-		{
-			description: "it should watch a slice of int",
-			field:       &config.Field7,
-			changeValue: etcd.Node{
-				Nodes: etcd.Nodes{
-					{
-						Key:   "/field7/0",
-						Value: "133",
-					},
-					{
-						Key:   "/field7/1",
-						Value: "212",
-					},
-				},
-			},
-			expected: []int{133, 212},
+		func() error {
+			_, err := c.SaveSliceElement(&cfg.Field4, 0)
+			c.Index()
+			return err
 		},
-		{
-			description: "it should watch a slice of int64",
-			field:       &config.Field8,
-			changeValue: etcd.Node{
+	}
+
+	for _, operation := range operations {
+		wg.Add(1)
+		go func(operation func() error) {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				if err := operation(); err != nil {
+					t.Errorf("Unexpected error in concurrent operation. %s", err)
+					return
+				}
+			}
+		}(operation)
+	}
+
+	for range fields {
+		mock.notifyChange(etcd.Node{Value: "changed"})
+	}
+
+	for range fields {
+		<-done
+	}
+
+	wg.Wait()
+}
+
+func TestValue(t *testing.T) {
+	type config struct {
+		Timeout Value[time.Duration]     `etcd:"timeout"`
+		Name    Value[string]            `etcd:"name"`
+		Labels  Value[map[string]string] `etcd:"labels"`
+		Field   struct {
+			Retries Value[int] `etcd:"retries"`
+		} `etcd:"field"`
+	}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/timeout", Value: "1m30s", ModifiedIndex: 10},
+			{Key: "/name", Value: "value1", ModifiedIndex: 11},
+			{
+				Key: "/labels",
+				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key:   "/field8/0",
-						Value: "1486",
-					},
-					{
-						Key:   "/field8/1",
-						Value: "2950",
-					},
+					{Key: "/labels/key1", Value: "value1"},
 				},
 			},
-			expected: []int64{1486, 2950},
-		},
-		{
-			description: "it should watch a slice of bool",
-			field:       &config.Field9,
-			changeValue: etcd.Node{
-				Nodes: etcd.Nodes{},
-			},
-			expected: []bool{},
-		},
-		{
-			description: "it should watch a structure",
-			field:       &config.Field10,
-			changeValue: etcd.Node{
+			{
+				Key: "/field",
+				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key:   "/field10/subfield1",
-						Value: "subvalue1 modified",
-					},
-					{
-						Key:   "/field10/subfield2",
-						Value: "529",
-					},
-					{
-						Key:   "/field10/subfield3",
-						Value: "861",
-					},
-					{
-						Key:   "/field10/subfield4",
-						Value: "false",
-					},
+					{Key: "/field/retries", Value: "3"},
 				},
 			},
-			expected: struct {
-				Subfield1 string `etcd:"subfield1"`
-				Subfield2 int    `etcd:"subfield2"`
-				Subfield3 int64  `etcd:"subfield3"`
-				Subfield4 bool   `etcd:"subfield4"`
-			}{
-				Subfield1: "subvalue1 modified",
-				Subfield2: int(529),
-				Subfield3: int64(861),
-				Subfield4: false,
-			},
-		},
-		{
-			description: "it should fail when watching an invalid field",
-			field:       "I'm not a valid field",
-			expectedErr: true,
-		},
-		{
-			description: "it should fail when watching a field not registered before",
-			field:       &struct{}{},
-			expectedErr: true,
 		},
 	}
 
-	for i, item := range data {
-		if DEBUG {
-			fmt.Printf(">>> Running TestWatch for index %d\n", i)
-		}
+	cfg := new(config)
+	c := Client{
+		etcdClient: mock,
+		config:     reflect.ValueOf(cfg),
+		info:       make(map[string]info),
+	}
+
+	c.preload(c.config, "")
 
-		mock := NewClientMock()
-		mock.root = &etcdData
+	var notified []string
+	unsubscribe := cfg.Name.Subscribe(func(value string) {
+		notified = append(notified, value)
+	})
 
-		c := Client{
-			etcdClient: mock,
-			config:     reflect.ValueOf(&config),
-			info:       make(map[string]info),
-		}
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
 
-		if item.init != nil {
-			item.init(mock)
-		}
+	if timeout := cfg.Timeout.Get(); timeout != 90*time.Second {
+		t.Errorf("Timeout mismatch. Expecting “%s”; found “%s”", 90*time.Second, timeout)
+	}
 
-		c.preload(c.config, "")
+	if labels := cfg.Labels.Get(); !reflect.DeepEqual(labels, map[string]string{"key1": "value1"}) {
+		t.Errorf("Labels mismatch. Found “%v”", labels)
+	}
 
-		done := make(chan bool)
-		stop, err := c.Watch(item.field, func() {
-			done <- true
-		})
+	if retries := cfg.Field.Retries.Get(); retries != 3 {
+		t.Errorf("Retries mismatch. Expecting “3”; found “%d”", retries)
+	}
 
-		if err == nil && item.expectedErr {
-			t.Errorf("Item %d, “%s”: error expected", i, item.description)
-			continue
+	if version, err := c.Version(&cfg.Name); err != nil || version != 11 {
+		t.Errorf("Version mismatch. Expecting “11”; found “%d” (%v)", version, err)
+	}
 
-		} else if err != nil && !item.expectedErr {
-			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
-			continue
-		}
+	// A watch must replace the value while it's being read
+	done := make(chan bool)
+	stop, err := c.Watch(&cfg.Name, func() {
+		done <- true
+	})
 
-		if err != nil {
-			continue
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+
+	finish := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		defer close(finished)
+
+		for {
+			select {
+			case <-finish:
+				return
+			default:
+				if name := cfg.Name.Get(); name != "value1" && name != "value2" {
+					t.Errorf("Unexpected name “%s”", name)
+				}
+			}
 		}
+	}()
 
-		mock.notifyChange(item.changeValue)
-		<-done
-		close(stop)
+	mock.notifyChange(etcd.Node{Value: "value2"})
+	<-done
+	close(stop)
+	close(finish)
+	<-finished
 
-		value := reflect.ValueOf(item.field)
-		if value.Kind() == reflect.Ptr {
-			value = value.Elem()
-		}
+	// Loading the same values again must not notify the subscribers
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error reloading the configuration. %s", err)
+	}
 
-		if !reflect.DeepEqual(value.Interface(), item.expected) {
-			t.Errorf("Item %d, “%s”: fields mismatch. Expecting “%+v”; found “%+v”",
-				i, item.description, item.expected, item.field)
-		}
+	if expected := []string{"value1", "value2"}; !reflect.DeepEqual(notified, expected) {
+		t.Errorf("Notifications mismatch. Expecting “%v”; found “%v”", expected, notified)
+	}
+
+	unsubscribe()
+	cfg.Name.Set("value3")
+	cfg.Timeout.Set(time.Minute)
+
+	if len(notified) != 2 {
+		t.Errorf("Subscriber notified after unsubscribing")
+	}
+
+	written, err := c.Save()
+	if err != nil {
+		t.Fatalf("Unexpected error saving the configuration. %s", err)
+	}
+
+	if expected := []string{"/timeout", "/name"}; !reflect.DeepEqual(written, expected) {
+		t.Errorf("Written paths mismatch. Expecting “%v”; found “%v”", expected, written)
+	}
+
+	if node, err := mock.find("/timeout"); err != nil || node.Value != "60000000000" {
+		t.Errorf("Timeout not saved. Found “%v” (%v)", node, err)
+	}
+
+	if unknown, err := c.Lint(); err != nil || len(unknown) > 0 {
+		t.Errorf("Unexpected unknown keys “%v” (%v)", unknown, err)
 	}
 }
 
-func BenchmarkWatch(b *testing.B) {
+func TestSnapshot(t *testing.T) {
+	type config struct {
+		Field1 string            `etcd:"field1"`
+		Field2 map[string]string `etcd:"field2"`
+		Field3 []struct {
+			Subfield1 string `etcd:"subfield1"`
+		} `etcd:"field3"`
+		Field4 Value[[]string] `etcd:"field4"`
+	}
+
 	mock := NewClientMock()
 	mock.root = &etcd.Node{
 		Dir: true,
 		Nodes: etcd.Nodes{
+			{Key: "/field1", Value: "value1"},
 			{
-				Key:   "/field",
-				Value: "value",
+				Key: "/field2",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field2/key1", Value: "value1"},
+				},
+			},
+			{
+				Key: "/field3",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field3/0",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{Key: "/field3/0/subfield1", Value: "value1"},
+						},
+					},
+				},
+			},
+			{
+				Key: "/field4",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field4/0", Value: "value1"},
+				},
 			},
 		},
 	}
+	mock.etcdIndex = 10
 
-	s := struct {
-		Field string `etcd:"field"`
-	}{}
-
+	cfg := new(config)
 	c := Client{
 		etcdClient: mock,
-		config:     reflect.ValueOf(&s),
+		config:     reflect.ValueOf(cfg),
 		info:       make(map[string]info),
 	}
 
 	c.preload(c.config, "")
 
-	called := make(chan bool)
-	for i := 0; i < b.N; i++ {
-		stop, err := c.Watch(&s.Field, func() {
-			called <- true
-		})
+	if snapshot := c.Snapshot(); snapshot.Index != 0 || snapshot.Config.(*config).Field1 != "" {
+		t.Errorf("Unexpected snapshot before loading. Found “%+v”", snapshot)
+	}
 
-		if err != nil {
-			b.Fatal(err)
-		}
+	if err := c.Load(); err != nil {
+		t.Fatalf("Unexpected error loading the configuration. %s", err)
+	}
 
-		mock.notifyChange(etcd.Node{
-			Value: "abc",
-		})
+	snapshot := c.Snapshot()
+	if snapshot != c.Snapshot() {
+		t.Errorf("Snapshot copied without changes in the configuration")
+	}
 
-		select {
-		case <-called:
-			close(stop)
-		}
+	if snapshot.Index != 10 {
+		t.Errorf("Index mismatch. Expecting “10”; found “%d”", snapshot.Index)
+	}
+
+	copied := snapshot.Config.(*config)
+	if copied == cfg {
+		t.Fatalf("Snapshot shares the configuration")
+	}
+
+	// Changes in the configuration must not affect the snapshot
+	cfg.Field2["key1"] = "changed"
+	cfg.Field3[0].Subfield1 = "changed"
+	cfg.Field4.Get()[0] = "changed"
+
+	if copied.Field1 != "value1" ||
+		copied.Field2["key1"] != "value1" ||
+		copied.Field3[0].Subfield1 != "value1" ||
+		!reflect.DeepEqual(copied.Field4.Get(), []string{"value1"}) {
+
+		t.Errorf("Snapshot mismatch. Found “%+v”", copied)
+	}
+
+	// A watch update must publish a new snapshot
+	done := make(chan bool)
+	stop, err := c.Watch(&cfg.Field1, func() {
+		done <- true
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error watching the field. %s", err)
+	}
+
+	mock.notifyChange(etcd.Node{Value: "value2"})
+	<-done
+	close(stop)
+
+	updated := c.Snapshot()
+	if updated == snapshot || updated.Config.(*config).Field1 != "value2" || updated.Index != 11 {
+		t.Errorf("Snapshot not updated. Found “%+v”", updated)
+	}
+
+	if copied.Field1 != "value1" {
+		t.Errorf("Previous snapshot was modified")
 	}
 }
 
@@ -2954,15 +6762,21 @@ func BenchmarkVersion(b *testing.B) {
 //////////////////////////////////////
 
 type clientMock struct {
-	root      *etcd.Node     // root node
-	etcdIndex uint64         // control update sequence
-	change    chan etcd.Node // simulate config changes for watch
+	sync.Mutex
+
+	root         *etcd.Node          // root node
+	etcdIndex    uint64              // control update sequence
+	change       chan etcd.Node      // simulate config changes for watch
+	events       chan *etcd.Response // simulate etcd events for watch
+	history      []*etcd.Response    // events used when watching from an index
+	clearedIndex uint64              // events before this index were removed from the history
 
 	// force errors for specific methods and paths
 	createDirErrors     map[string]error
 	createInOrderErrors map[string]error
 	setErrors           map[string]error
 	getErrors           map[string]error
+	deleteErrors        map[string]error
 	watchErrors         map[string]error
 }
 
@@ -2972,10 +6786,12 @@ func NewClientMock() *clientMock {
 			Dir: true,
 		},
 		change:              make(chan etcd.Node),
+		events:              make(chan *etcd.Response),
 		createDirErrors:     make(map[string]error),
 		createInOrderErrors: make(map[string]error),
 		setErrors:           make(map[string]error),
 		getErrors:           make(map[string]error),
+		deleteErrors:        make(map[string]error),
 		watchErrors:         make(map[string]error),
 	}
 }
@@ -2985,6 +6801,9 @@ func (c *clientMock) CreateDir(path string, ttl uint64) (*etcd.Response, error)
 		fmt.Printf(" - Creating path %s\n", path)
 	}
 
+	c.Lock()
+	defer c.Unlock()
+
 	// CreatDir error is a special case, because we could have the "already created" error
 	err := c.createDirErrors[path]
 	if etcderr, ok := err.(*etcd.EtcdError); ok && etcderr.ErrorCode != int(etcdErrorCodeNodeExist) {
@@ -3020,11 +6839,17 @@ func (c *clientMock) CreateDir(path string, ttl uint64) (*etcd.Response, error)
 
 		current.Nodes = append(current.Nodes, newNode)
 		current = newNode
+
+		c.remember(&etcd.Response{
+			Action:    "create",
+			Node:      current,
+			EtcdIndex: c.etcdIndex,
+		})
 	}
 
 	return &etcd.Response{
 		Action:    "create",
-		Node:      current,
+		Node:      copyNode(current),
 		EtcdIndex: c.etcdIndex,
 	}, err
 }
@@ -3034,6 +6859,9 @@ func (c *clientMock) CreateInOrder(path string, value string, ttl uint64) (*etcd
 		fmt.Printf(" - Creating in order path %s with value “%s”\n", path, value)
 	}
 
+	c.Lock()
+	defer c.Unlock()
+
 	if err := c.createInOrderErrors[path]; err != nil {
 		return nil, err
 	}
@@ -3063,11 +6891,14 @@ func (c *clientMock) CreateInOrder(path string, value string, ttl uint64) (*etcd
 	}
 	current.Nodes = append(current.Nodes, newNode)
 
-	return &etcd.Response{
+	response := &etcd.Response{
 		Action:    "create",
 		Node:      newNode,
 		EtcdIndex: c.etcdIndex,
-	}, nil
+	}
+
+	c.remember(response)
+	return response, nil
 }
 
 func (c *clientMock) Set(path string, value string, ttl uint64) (*etcd.Response, error) {
@@ -3075,6 +6906,9 @@ func (c *clientMock) Set(path string, value string, ttl uint64) (*etcd.Response,
 		fmt.Printf(" - Setting path %s with value “%s”\n", path, value)
 	}
 
+	c.Lock()
+	defer c.Unlock()
+
 	if err := c.setErrors[path]; err != nil {
 		return nil, err
 	}
@@ -3128,12 +6962,15 @@ func (c *clientMock) Set(path string, value string, ttl uint64) (*etcd.Response,
 		action = "create"
 	}
 
-	return &etcd.Response{
+	response := &etcd.Response{
 		Action:    action,
-		Node:      current,
+		Node:      copyNode(current),
 		PrevNode:  oldNode,
 		EtcdIndex: c.etcdIndex,
-	}, nil
+	}
+
+	c.remember(response)
+	return response, nil
 }
 
 func (c *clientMock) Get(path string, sort, recursive bool) (*etcd.Response, error) {
@@ -3141,11 +6978,42 @@ func (c *clientMock) Get(path string, sort, recursive bool) (*etcd.Response, err
 		fmt.Printf(" - Getting path %s\n", path)
 	}
 
+	c.Lock()
+	defer c.Unlock()
+
 	if err := c.getErrors[path]; err != nil {
 		return nil, err
 	}
 
-	current := c.root
+	current, err := c.find(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if sort {
+		sortNodes(current)
+	}
+
+	return &etcd.Response{
+		Action:    "get",
+		Node:      copyNode(current),
+		EtcdIndex: c.etcdIndex,
+	}, nil
+}
+
+func (c *clientMock) Delete(path string, recursive bool) (*etcd.Response, error) {
+	if DEBUG {
+		fmt.Printf(" - Deleting path %s\n", path)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if err := c.deleteErrors[path]; err != nil {
+		return nil, err
+	}
+
+	parent := c.root
 	currentPath := c.root.Key
 	parts := strings.Split(path, "/")
 
@@ -3154,24 +7022,46 @@ func (c *clientMock) Get(path string, sort, recursive bool) (*etcd.Response, err
 		currentPath += "/" + part
 
 		found := false
-		for _, n := range current.Nodes {
-			if n.Key == currentPath {
+		for j, n := range parent.Nodes {
+			if n.Key != currentPath {
+				continue
+			}
+
+			if i < len(parts)-1 {
+				parent = n
 				found = true
-				current = n
 				break
 			}
+
+			if n.Dir && !recursive {
+				return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeNotFile), Message: path}
+			}
+
+			c.etcdIndex++
+			parent.Nodes = append(parent.Nodes[:j], parent.Nodes[j+1:]...)
+
+			response := &etcd.Response{
+				Action: "delete",
+				Node: &etcd.Node{
+					Key:           path,
+					Dir:           n.Dir,
+					ModifiedIndex: c.etcdIndex,
+					CreatedIndex:  n.CreatedIndex,
+				},
+				PrevNode:  n,
+				EtcdIndex: c.etcdIndex,
+			}
+
+			c.remember(response)
+			return response, nil
 		}
 
 		if !found {
-			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
+			break
 		}
 	}
 
-	return &etcd.Response{
-		Action:    "get",
-		Node:      current,
-		EtcdIndex: c.etcdIndex,
-	}, nil
+	return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
 }
 
 func (c *clientMock) Watch(
@@ -3186,10 +7076,127 @@ func (c *clientMock) Watch(
 		fmt.Printf(" - Watching path %s\n", path)
 	}
 
-	if err := c.watchErrors[path]; err != nil {
+	c.Lock()
+	err := c.watchErrors[path]
+
+	if err == nil && waitIndex > 0 && waitIndex < c.clearedIndex {
+		err = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeEventIndexCleared), Message: path}
+	}
+
+	// When there's an index we look for the events in the history
+	var events []*etcd.Response
+	if err == nil && waitIndex > 0 {
+		for _, event := range c.history {
+			if event.Node.ModifiedIndex >= waitIndex &&
+				(event.Node.Key == path || (recursive && (path == "/" || strings.HasPrefix(event.Node.Key, path+"/")))) {
+
+				if receiver == nil {
+					c.Unlock()
+					return event, nil
+				}
+
+				events = append(events, event)
+			}
+		}
+	}
+
+	var current *etcd.Node
+	if err == nil {
+		current, err = c.find(path)
+	}
+	c.Unlock()
+
+	if err != nil {
 		return nil, err
 	}
 
+	for _, event := range events {
+		select {
+		case receiver <- event:
+			waitIndex = event.Node.ModifiedIndex + 1
+		case <-stop:
+			return nil, etcd.ErrWatchStoppedByUser
+		}
+	}
+
+	// Like go-etcd, a long-term watch only returns when it's stopped
+	for {
+		select {
+		case node := <-c.change:
+			c.Lock()
+			current.Value = node.Value
+			current.Nodes = node.Nodes
+
+			response := &etcd.Response{
+				Action:    "get",
+				Node:      copyNode(current),
+				EtcdIndex: c.etcdIndex,
+			}
+			c.Unlock()
+
+			receiver <- response
+
+		case response := <-c.events:
+			// events already sent from the history are ignored
+			if waitIndex == 0 || response.Node.ModifiedIndex >= waitIndex {
+				receiver <- response
+			}
+
+		case <-stop:
+			return nil, etcd.ErrWatchStoppedByUser
+		}
+	}
+}
+
+// remember stores a copy of the response in the events history. The caller must hold the lock
+func (c *clientMock) remember(response *etcd.Response) {
+	event := *response
+
+	node := *response.Node
+	node.Nodes = nil
+	event.Node = &node
+
+	if response.PrevNode != nil {
+		prevNode := *response.PrevNode
+		prevNode.Nodes = nil
+		event.PrevNode = &prevNode
+	}
+
+	c.history = append(c.history, &event)
+}
+
+// copyNode duplicates the node tree, so the responses are not affected by later changes, in the same
+// way of the responses decoded from etcd. The caller must hold the lock
+func copyNode(node *etcd.Node) *etcd.Node {
+	copied := *node
+	copied.Nodes = nil
+
+	for _, child := range node.Nodes {
+		copied.Nodes = append(copied.Nodes, copyNode(child))
+	}
+
+	return &copied
+}
+
+// sortNodes sorts the children keys as strings, in the same way of etcd
+func sortNodes(node *etcd.Node) {
+	for i := 1; i < len(node.Nodes); i++ {
+		for j := i; j > 0 && node.Nodes[j].Key < node.Nodes[j-1].Key; j-- {
+			node.Nodes[j], node.Nodes[j-1] = node.Nodes[j-1], node.Nodes[j]
+		}
+	}
+
+	for _, child := range node.Nodes {
+		sortNodes(child)
+	}
+}
+
+// find looks for the node of the path in the tree. The caller must hold the lock
+func (c *clientMock) find(path string) (*etcd.Node, error) {
+	if path == "/" {
+		return c.root, nil
+	}
+
 	current := c.root
 	currentPath := c.root.Key
 	parts := strings.Split(path, "/")
@@ -3208,24 +7215,11 @@ func (c *clientMock) Watch(
 		}
 
 		if !found {
-			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
-		}
-	}
-
-	select {
-	case node := <-c.change:
-		current.Value = node.Value
-		current.Nodes = node.Nodes
-
-		receiver <- &etcd.Response{
-			Action:    "get",
-			Node:      current,
-			EtcdIndex: c.etcdIndex,
+			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path, Index: c.etcdIndex}
 		}
-	case <-stop:
 	}
 
-	return nil, nil
+	return current, nil
 }
 
 func (c *clientMock) createDirsInPath(path string, ttl uint64) *etcd.Node {
@@ -3275,9 +7269,39 @@ func (c *clientMock) createDirsInPath(path string, ttl uint64) *etcd.Node {
 	return current
 }
 
+// notifyEvent applies a change in the tree and sends the event to the watch. Actions "delete" and
+// "expire" remove the path, other actions set the value
+func (c *clientMock) notifyEvent(action, path, value string) {
+	var response *etcd.Response
+	var err error
+
+	switch action {
+	case "delete", "expire":
+		response, err = c.Delete(path, true)
+	default:
+		response, err = c.Set(path, value, 0)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	c.Lock()
+	response.Action = action
+	if len(c.history) > 0 {
+		c.history[len(c.history)-1].Action = action
+	}
+	c.Unlock()
+
+	c.events <- response
+}
+
 func (c *clientMock) notifyChange(node etcd.Node) {
+	c.Lock()
 	c.etcdIndex++
 	node.ModifiedIndex = c.etcdIndex
+	c.Unlock()
+
 	c.change <- node
 }
 
@@ -0,0 +1,109 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"reflect"
+)
+
+// Snapshot is a copy of the configuration in a specific moment. It is never modified by the client,
+// so it can be read without locks while watches are updating the configuration
+type Snapshot struct {
+	Config interface{} // pointer to the copy of the configuration structure
+	Index  uint64      // etcd index of the last load or update reflected in the copy
+}
+
+// Snapshot returns the copy of the configuration published after the last successful load or watch
+// update. The copy is only created when the configuration changes, so it's cheap to retrieve a
+// snapshot for each request. Changes made directly in the configuration structure aren't visible in
+// the snapshot until the next load or update
+func (c *Client) Snapshot() *Snapshot {
+	if snapshot := c.snapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+
+	c.publish(c.Index())
+	return c.snapshot.Load()
+}
+
+// publish creates a new snapshot from the current state of the configuration. The index never goes
+// back, as a field update can be older than the last load
+func (c *Client) publish(index uint64) {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	if previous := c.snapshot.Load(); previous != nil && previous.Index > index {
+		index = previous.Index
+	}
+
+	c.configLock.RLock()
+	config := reflect.New(c.config.Elem().Type())
+	deepCopy(config.Elem(), c.config.Elem())
+	c.configLock.RUnlock()
+
+	c.snapshot.Store(&Snapshot{
+		Config: config.Interface(),
+		Index:  index,
+	})
+}
+
+// deepCopy copies the field recursively, so that the copy doesn't share maps, slices, pointers or
+// Value fields with the original. Unexported fields are copied as they are
+func deepCopy(dst, src reflect.Value) {
+	if holder, ok := holderOf(dst); ok {
+		if srcHolder, _ := holderOf(src); srcHolder != nil && srcHolder.loaded() {
+			value := reflect.New(holder.elemType()).Elem()
+			deepCopy(value, srcHolder.reflectValue())
+			holder.store(value)
+		}
+		return
+	}
+
+	switch src.Kind() {
+	case reflect.Struct:
+		copyField(dst, src)
+		for i := 0; i < dst.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				deepCopy(dst.Field(i), src.Field(i))
+			}
+		}
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+
+		copied := reflect.MakeMap(src.Type())
+		for _, key := range src.MapKeys() {
+			value := reflect.New(src.Type().Elem()).Elem()
+			deepCopy(value, src.MapIndex(key))
+			copied.SetMapIndex(key, value)
+		}
+		dst.Set(copied)
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+
+		copied := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			deepCopy(copied.Index(i), src.Index(i))
+		}
+		dst.Set(copied)
+
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+
+		copied := reflect.New(src.Type().Elem())
+		deepCopy(copied.Elem(), src.Elem())
+		dst.Set(copied)
+
+	default:
+		dst.Set(src)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"sync"
+)
+
+// Unsubscribe stops the watch of a subscription and closes its channel
+type Unsubscribe func()
+
+// OverflowPolicy defines what happens when a subscription channel is full and a new event arrives
+type OverflowPolicy int
+
+// List of possible overflow policies of a subscription
+const (
+	// OverflowCoalesce replaces the events waiting in the channel by a single event that describes
+	// the last change, with all changed paths in Event.Paths. No change is lost, and the watch is
+	// never blocked
+	OverflowCoalesce OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest event waiting in the channel to make room for the new
+	// one. The watch is never blocked
+	OverflowDropOldest
+
+	// OverflowBlock waits until the consumer reads the channel. The watch is blocked (and changes
+	// accumulate in etcd) while the consumer is slow
+	OverflowBlock
+)
+
+// WithBuffer defines the size of the channel of a subscription and what to do when it's full. By
+// default the channel has room for one event and the events are coalesced
+func WithBuffer(size int, overflow OverflowPolicy) WatchOption {
+	return func(options *watchOptions) {
+		options.buffer = size
+		options.overflow = overflow
+	}
+}
+
+// Subscribe watches the field and sends the changes to the returned channel, so that they can be
+// handled in a select loop. The channel is closed after the subscription is stopped with the
+// returned function. The watch works in the same way of WatchEvents, and the same options can be
+// used, plus WithBuffer to control what happens when the consumer is slow
+func (c *Client) Subscribe(field interface{}, opts ...WatchOption) (<-chan Event, Unsubscribe, error) {
+	options := newWatchOptions(opts)
+
+	buffer := options.buffer
+	if buffer < 1 && options.overflow != OverflowBlock {
+		// events can only be dropped or coalesced when they wait in the channel
+		buffer = 1
+	} else if buffer < 0 {
+		buffer = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan Event, buffer)
+
+	done, err := c.WatchEvents(ctx, field, func(event Event) {
+		switch options.overflow {
+		case OverflowBlock:
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+
+		case OverflowDropOldest:
+			for {
+				select {
+				case events <- event:
+					return
+				default:
+				}
+
+				select {
+				case <-events:
+				default:
+				}
+			}
+
+		default:
+			for {
+				select {
+				case events <- event:
+					return
+				default:
+				}
+
+				pending := []Event{event}
+				for len(events) > 0 {
+					select {
+					case older := <-events:
+						pending = append([]Event{older}, pending...)
+					default:
+					}
+				}
+
+				event = coalesce(pending, field)
+			}
+		}
+	}, opts...)
+
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			cancel()
+			<-done
+			close(events)
+		})
+	}, nil
+}
+
+// coalesce merges the events in a single event that describes the last change. The paths of all
+// events are kept, and when the events refer to different fields the watched field is used. The
+// changed entries of a collection are merged, so they are relative to the value before the first
+// event
+func coalesce(events []Event, field interface{}) Event {
+	event := events[len(events)-1]
+
+	var paths []string
+	sameField := true
+
+	for _, e := range events {
+		paths = append(paths, e.Paths...)
+		sameField = sameField && e.Field == event.Field
+	}
+
+	event.Paths = uniquePaths(paths)
+	event.Added, event.Removed, event.Modified = nil, nil, nil
+
+	if !sameField {
+		event.Field = field
+		return event
+	}
+
+	states := make(map[string]string)
+	merge := func(keys []string, state string) {
+		for _, key := range keys {
+			switch previous := states[key]; {
+			case previous == "added" && state == "removed":
+				delete(states, key)
+			case previous == "added":
+				// still a new entry
+			case previous == "removed" && state == "added":
+				states[key] = "modified"
+			default:
+				states[key] = state
+			}
+		}
+	}
+
+	for _, e := range events {
+		merge(e.Added, "added")
+		merge(e.Removed, "removed")
+		merge(e.Modified, "modified")
+	}
+
+	for key, state := range states {
+		switch state {
+		case "added":
+			event.Added = append(event.Added, key)
+		case "removed":
+			event.Removed = append(event.Removed, key)
+		case "modified":
+			event.Modified = append(event.Modified, key)
+		}
+	}
+
+	sortEntries(event.Added)
+	sortEntries(event.Removed)
+	sortEntries(event.Modified)
+	return event
+}
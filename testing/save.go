@@ -56,17 +56,18 @@ func main() {
 		return
 	}
 
-	if err := etc.Save(); err != nil {
+	if _, err := etc.Save(); err != nil {
 		fmt.Println(err)
 		return
 	}
 
 	config.Key1.Subkey1 = "subkey1 changed"
 
-	if err := etc.SaveField(&config.Key1.Subkey1); err != nil {
+	written, err := etc.SaveField(&config.Key1.Subkey1)
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Println("Saved!")
+	fmt.Printf("Saved! %v\n", written)
 }
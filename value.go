@@ -0,0 +1,200 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Value stores a configuration field that can be read while loads and watches are updating it,
+// without holding any lock. It can be used as a field of the configuration structure with the
+// 'etcd' tag, in the same way of the type that it stores:
+//
+//	type Config struct {
+//	  Timeout etcetera.Value[time.Duration] `etcd:"timeout"`
+//	}
+//
+// The stored value is replaced atomically, so types with references (maps and slices) must not be
+// modified after Set or Get. A Value must not be copied after its first use
+type Value[T any] struct {
+	current atomic.Pointer[T]
+
+	lock        sync.Mutex
+	subscribers map[int]func(T)
+	sequence    int
+}
+
+// Get returns the current value. When the value wasn't loaded or set yet, the zero value of the type
+// is returned
+func (v *Value[T]) Get() T {
+	if current := v.current.Load(); current != nil {
+		return *current
+	}
+
+	var zero T
+	return zero
+}
+
+// Set replaces the current value and notifies the subscribers. The new value is saved in etcd in
+// the next Save or SaveField
+func (v *Value[T]) Set(value T) {
+	v.current.Store(&value)
+	v.notify()
+}
+
+// Subscribe registers a function that is called with the new value every time that it changes (by a
+// load, a watch or Set). The function runs in the go routine that changed the value. The returned
+// function removes the subscription
+func (v *Value[T]) Subscribe(fn func(T)) (unsubscribe func()) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.subscribers == nil {
+		v.subscribers = make(map[int]func(T))
+	}
+
+	v.sequence++
+	id := v.sequence
+	v.subscribers[id] = fn
+
+	return func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		delete(v.subscribers, id)
+	}
+}
+
+func (v *Value[T]) notify() {
+	v.lock.Lock()
+	subscribers := make([]func(T), 0, len(v.subscribers))
+	for _, fn := range v.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	v.lock.Unlock()
+
+	value := v.Get()
+	for _, fn := range subscribers {
+		fn(value)
+	}
+}
+
+func (v *Value[T]) elemType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (v *Value[T]) loaded() bool {
+	return v.current.Load() != nil
+}
+
+func (v *Value[T]) reflectValue() reflect.Value {
+	return reflect.ValueOf(v.Get())
+}
+
+func (v *Value[T]) store(value reflect.Value) bool {
+	stored := value.Interface().(T)
+	previous := v.current.Swap(&stored)
+	return previous == nil || !reflect.DeepEqual(*previous, stored)
+}
+
+// valueHolder allows the library to fill and save the Value fields using reflection, without
+// knowing the type that they store
+type valueHolder interface {
+	elemType() reflect.Type
+	loaded() bool
+	reflectValue() reflect.Value
+	store(value reflect.Value) (changed bool)
+	notify()
+}
+
+var valueHolderType = reflect.TypeOf((*valueHolder)(nil)).Elem()
+
+// holderOf returns the Value stored in the field, if the field is one
+func holderOf(field reflect.Value) (valueHolder, bool) {
+	if field.Kind() != reflect.Struct || !field.CanAddr() ||
+		!field.Addr().Type().Implements(valueHolderType) {
+
+		return nil, false
+	}
+
+	return field.Addr().Interface().(valueHolder), true
+}
+
+// holderType returns the type stored by a Value type. For other types the given type is returned
+func holderType(t reflect.Type) reflect.Type {
+	if t.Kind() != reflect.Struct || !reflect.PtrTo(t).Implements(valueHolderType) {
+		return t
+	}
+
+	return reflect.New(t).Interface().(valueHolder).elemType()
+}
+
+// hasHolder checks if the structure type has Value fields, directly or in substructures
+func hasHolder(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	if reflect.PtrTo(t).Implements(valueHolderType) {
+		return true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if hasHolder(t.Field(i).Type) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyField copies the field without the Value fields, that are left empty. Unexported fields of
+// structures with Value fields are not copied
+func copyField(dst, src reflect.Value) {
+	if _, ok := holderOf(dst); ok {
+		return
+	}
+
+	if !hasHolder(dst.Type()) {
+		dst.Set(src)
+		return
+	}
+
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Field(i).CanSet() {
+			copyField(dst.Field(i), src.Field(i))
+		}
+	}
+}
+
+// assign copies the field to the configuration. Value fields are stored atomically, and only when
+// they were filled. The Value fields that changed are returned, so that the subscribers can be
+// notified
+func assign(dst, src reflect.Value) []valueHolder {
+	if holder, ok := holderOf(dst); ok {
+		srcHolder, _ := holderOf(src)
+		if srcHolder == nil || !srcHolder.loaded() || !holder.store(srcHolder.reflectValue()) {
+			return nil
+		}
+
+		return []valueHolder{holder}
+	}
+
+	if !hasHolder(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	var changed []valueHolder
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Field(i).CanSet() {
+			changed = append(changed, assign(dst.Field(i), src.Field(i))...)
+		}
+	}
+
+	return changed
+}